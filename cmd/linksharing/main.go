@@ -15,6 +15,7 @@ import (
 	"go.uber.org/zap"
 
 	"storj.io/common/fpath"
+	"storj.io/common/memory"
 	"storj.io/linksharing"
 	"storj.io/linksharing/httpserver"
 	"storj.io/linksharing/sharing"
@@ -24,25 +25,46 @@ import (
 
 // LinkSharing defines link sharing configuration.
 type LinkSharing struct {
-	Address               string        `user:"true" help:"public address to listen on" default:":8080"`
-	AddressTLS            string        `user:"true" help:"public tls address to listen on" default:":8443"`
-	LetsEncrypt           bool          `user:"true" help:"use lets-encrypt to handle TLS certificates" default:"false"`
-	CertFile              string        `user:"true" help:"server certificate file" devDefault:"" releaseDefault:"server.crt.pem"`
-	KeyFile               string        `user:"true" help:"server key file" devDefault:"" releaseDefault:"server.key.pem"`
-	PublicURL             string        `user:"true" help:"comma separated list of public urls for the server" devDefault:"http://localhost:8080" releaseDefault:""`
-	GeoLocationDB         string        `user:"true" help:"maxmind database file path" devDefault:"" releaseDefault:""`
-	TxtRecordTTL          time.Duration `user:"true" help:"max ttl (seconds) for website hosting txt record cache" devDefault:"10s" releaseDefault:"1h"`
-	AuthServiceBaseURL    string        `user:"true" help:"base url to use for resolving access key ids" default:""`
-	AuthServiceToken      string        `user:"true" help:"auth token for giving access to the auth service" default:""`
-	DNSServer             string        `user:"true" help:"dns server address to use for TXT resolution" default:"1.1.1.1:53"`
-	StaticSourcesPath     string        `user:"true" help:"the path to where web assets are located" default:"./web/static"`
-	Templates             string        `user:"true" help:"the path to where renderable templates are located" default:"./web"`
-	LandingRedirectTarget string        `user:"true" help:"the url to redirect empty requests to" default:"https://www.storj.io/"`
-	RedirectHTTPS         bool          `user:"true" help:"redirect to HTTPS" devDefault:"false" releaseDefault:"true"`
-	UseQosAndCC           bool          `user:"true" help:"use congestion control and QOS settings" default:"true"`
-	ClientTrustedIPSList  []string      `user:"true" help:"list of clients IPs (comma separated) which are trusted; usually used when the service run behinds gateways, load balancers, etc."`
-	UseClientIPHeaders    bool          `user:"true" help:"use the headers sent by the client to identify its IP. When true the list of IPs set by --client-trusted-ips-list, when not empty, is used" default:"true"`
-	ConnectionPool        ConnectionPoolConfig
+	Address                   string        `user:"true" help:"public address to listen on" default:":8080"`
+	AddressTLS                string        `user:"true" help:"public tls address to listen on" default:":8443"`
+	LetsEncrypt               bool          `user:"true" help:"use lets-encrypt to handle TLS certificates" default:"false"`
+	LetsEncryptOnDemand       bool          `user:"true" help:"issue lets-encrypt certificates for hosted domains on their first TLS handshake; requires --lets-encrypt" default:"false"`
+	ACMEDirectoryURL          string        `user:"true" help:"ACME directory url to use with lets-encrypt instead of the Let's Encrypt production directory" default:""`
+	CertFile                  string        `user:"true" help:"server certificate file" devDefault:"" releaseDefault:"server.crt.pem"`
+	KeyFile                   string        `user:"true" help:"server key file" devDefault:"" releaseDefault:"server.key.pem"`
+	PublicURL                 string        `user:"true" help:"comma separated list of public urls for the server" devDefault:"http://localhost:8080" releaseDefault:""`
+	GeoLocationDB             string        `user:"true" help:"maxmind database file path" devDefault:"" releaseDefault:""`
+	TxtRecordTTL              time.Duration `user:"true" help:"max ttl (seconds) for website hosting txt record cache" devDefault:"10s" releaseDefault:"1h"`
+	TxtRecordNegativeTTL      time.Duration `user:"true" help:"ttl for caching hostnames without a valid website hosting txt record (0 disables)" default:"1m"`
+	TxtRecordStaleIfError     time.Duration `user:"true" help:"how long past its ttl a website hosting txt record keeps being served while refreshing it fails (0 disables)" default:"24h"`
+	TxtRecordCacheEntries     int           `user:"true" help:"max number of entries in the website hosting txt record cache (0 is unbounded)" default:"100000"`
+	TxtRecordCacheSize        memory.Size   `user:"true" help:"max approximate size of the website hosting txt record cache (0 is unbounded)" default:"256MiB"`
+	TxtRecordRefreshers       int           `user:"true" help:"number of workers refreshing website hosting txt records in the background" default:"4"`
+	AccessRevalidation        time.Duration `user:"true" help:"how often access keys of cached website hosting txt records are checked for revocation with the auth service (0 disables)" default:"5m"`
+	TxtRecordWarmup           string        `user:"true" help:"comma separated list of hostnames whose website hosting txt records are resolved at startup" default:""`
+	TxtRecordWarmupFile       string        `user:"true" help:"path to a file listing hostnames, one per line, whose website hosting txt records are resolved at startup" default:""`
+	TxtRecordSnapshot         string        `user:"true" help:"path to a file the hostnames of the website hosting txt record cache are saved to, for resolving them at startup" default:""`
+	TxtRecordSnapshotInterval time.Duration `user:"true" help:"how often the hostnames of the website hosting txt record cache are saved to --txt-record-snapshot besides on shutdown (0 only saves on shutdown)" default:"5m"`
+	RootPointerTTL            time.Duration `user:"true" help:"how long the root named by the storj-root-pointer object of a website is cached" default:"10s"`
+	AuthServiceBaseURL        string        `user:"true" help:"base url to use for resolving access key ids" default:""`
+	AuthServiceToken          string        `user:"true" help:"auth token for giving access to the auth service" default:""`
+	HostsFile                 string        `user:"true" help:"path to a yaml or json file mapping hostnames to the root and access of their sites, checked before txt records" default:""`
+	HostInfo                  bool          `user:"true" help:"serve /.well-known/storj-linksharing on hosted domains, showing how their txt records were understood with the access redacted; requires --host-info-token" default:"false"`
+	HostInfoToken             string        `user:"true" help:"bearer token required for /.well-known/storj-linksharing" default:""`
+	VerifyHostTargets         bool          `user:"true" help:"only serve hosted domains that resolve to the public urls or --host-target-addresses, by CNAME or address" default:"false"`
+	HostTargetAddresses       string        `user:"true" help:"comma separated list of additional IP addresses or CIDR networks hosted domains may resolve to, e.g. of load balancers" default:""`
+	DNSServer                 string        `user:"true" help:"comma separated list of dns server addresses to use for TXT resolution; host:port (tcp), udp://host:port, tls://host:port or https://host/dns-query" default:"1.1.1.1:53"`
+	DNSSEC                    string        `user:"true" help:"dnssec validation policy for txt records of hosted domains (off, prefer or require); prefer only rejects bad signatures and doesn't protect against stripped ones" default:"off"`
+	DNSSECHosts               string        `user:"true" help:"comma separated list of host=policy pairs overriding the dnssec policy for hosts and their subdomains" default:""`
+	StaticSourcesPath         string        `user:"true" help:"the path to where web assets are located" default:"./web/static"`
+	Templates                 string        `user:"true" help:"the path to where renderable templates are located" default:"./web"`
+	LandingRedirectTarget     string        `user:"true" help:"the url to redirect empty requests to" default:"https://www.storj.io/"`
+	IndexFiles                string        `user:"true" help:"comma separated list of index documents to look up, in order, when a prefix is requested" default:"index.html"`
+	RedirectHTTPS             bool          `user:"true" help:"redirect to HTTPS" devDefault:"false" releaseDefault:"true"`
+	UseQosAndCC               bool          `user:"true" help:"use congestion control and QOS settings" default:"true"`
+	ClientTrustedIPSList      []string      `user:"true" help:"list of clients IPs (comma separated) which are trusted; usually used when the service run behinds gateways, load balancers, etc."`
+	UseClientIPHeaders        bool          `user:"true" help:"use the headers sent by the client to identify its IP. When true the list of IPs set by --client-trusted-ips-list, when not empty, is used" default:"true"`
+	ConnectionPool            ConnectionPoolConfig
 }
 
 // ConnectionPoolConfig is a config struct for configuring RPC connection pool options.
@@ -68,9 +90,16 @@ var (
 		RunE:        cmdSetup,
 		Annotations: map[string]string{"type": "setup"},
 	}
+	checkHostCmd = &cobra.Command{
+		Use:   "check-host <hostname>",
+		Short: "Check the dns setup of a hosted website",
+		Args:  cobra.ExactArgs(1),
+		RunE:  cmdCheckHost,
+	}
 
-	runCfg   LinkSharing
-	setupCfg LinkSharing
+	runCfg       LinkSharing
+	setupCfg     LinkSharing
+	checkHostCfg LinkSharing
 
 	confDir string
 )
@@ -81,8 +110,10 @@ func init() {
 	defaults := cfgstruct.DefaultsFlag(rootCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(setupCmd)
+	rootCmd.AddCommand(checkHostCmd)
 	process.Bind(runCmd, &runCfg, defaults, cfgstruct.ConfDir(confDir))
 	process.Bind(setupCmd, &setupCfg, defaults, cfgstruct.ConfDir(confDir), cfgstruct.SetupMode())
+	process.Bind(checkHostCmd, &checkHostCfg, defaults, cfgstruct.ConfDir(confDir))
 }
 
 func cmdRun(cmd *cobra.Command, args []string) (err error) {
@@ -95,6 +126,11 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 
 	publicURLs := strings.Split(runCfg.PublicURL, ",")
 
+	handlerConfig, err := newHandlerConfig(runCfg)
+	if err != nil {
+		return err
+	}
+
 	peer, err := linksharing.New(log, linksharing.Config{
 		Server: httpserver.Config{
 			Name:       "Link Sharing",
@@ -106,27 +142,14 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 				KeyFile:     runCfg.KeyFile,
 				PublicURLs:  publicURLs,
 				ConfigDir:   confDir,
+
+				ACMEDirectoryURL: runCfg.ACMEDirectoryURL,
 			},
 			ShutdownTimeout: -1,
 		},
-		Handler: sharing.Config{
-			URLBases:              publicURLs,
-			Templates:             runCfg.Templates,
-			StaticSourcesPath:     runCfg.StaticSourcesPath,
-			RedirectHTTPS:         runCfg.RedirectHTTPS,
-			LandingRedirectTarget: runCfg.LandingRedirectTarget,
-			TxtRecordTTL:          runCfg.TxtRecordTTL,
-			AuthServiceConfig: sharing.AuthServiceConfig{
-				BaseURL: runCfg.AuthServiceBaseURL,
-				Token:   runCfg.AuthServiceToken,
-			},
-			DNSServer:            runCfg.DNSServer,
-			ConnectionPool:       sharing.ConnectionPoolConfig(runCfg.ConnectionPool),
-			UseQosAndCC:          runCfg.UseQosAndCC,
-			ClientTrustedIPsList: runCfg.ClientTrustedIPSList,
-			UseClientIPHeaders:   runCfg.UseClientIPHeaders,
-		},
+		Handler:       handlerConfig,
 		GeoLocationDB: runCfg.GeoLocationDB,
+		OnDemandTLS:   runCfg.LetsEncryptOnDemand,
 	})
 	if err != nil {
 		return err
@@ -138,6 +161,86 @@ func cmdRun(cmd *cobra.Command, args []string) (err error) {
 	return errs.Combine(runError, closeError)
 }
 
+// newHandlerConfig returns the configuration of the handler from cfg.
+func newHandlerConfig(cfg LinkSharing) (sharing.Config, error) {
+	dnssecPolicy, err := sharing.ParseDNSSECPolicy(cfg.DNSSEC)
+	if err != nil {
+		return sharing.Config{}, err
+	}
+	dnssecHostPolicies, err := sharing.ParseDNSSECHostPolicies(cfg.DNSSECHosts)
+	if err != nil {
+		return sharing.Config{}, err
+	}
+
+	return sharing.Config{
+		URLBases:              strings.Split(cfg.PublicURL, ","),
+		Templates:             cfg.Templates,
+		StaticSourcesPath:     cfg.StaticSourcesPath,
+		RedirectHTTPS:         cfg.RedirectHTTPS,
+		LandingRedirectTarget: cfg.LandingRedirectTarget,
+		IndexFiles:            strings.Split(cfg.IndexFiles, ","),
+		TxtRecordTTL:          cfg.TxtRecordTTL,
+		TxtRecordNegativeTTL:  cfg.TxtRecordNegativeTTL,
+		TxtRecordStaleIfError: cfg.TxtRecordStaleIfError,
+		TxtRecordCacheEntries: cfg.TxtRecordCacheEntries,
+		TxtRecordCacheSize:    cfg.TxtRecordCacheSize,
+
+		TxtRecordRefreshWorkers:    cfg.TxtRecordRefreshers,
+		AccessRevalidationInterval: cfg.AccessRevalidation,
+		RootPointerTTL:             cfg.RootPointerTTL,
+
+		TxtRecordWarmupHosts:      sharing.SplitList(cfg.TxtRecordWarmup),
+		TxtRecordWarmupHostsFile:  cfg.TxtRecordWarmupFile,
+		TxtRecordSnapshotFile:     cfg.TxtRecordSnapshot,
+		TxtRecordSnapshotInterval: cfg.TxtRecordSnapshotInterval,
+		AuthServiceConfig: sharing.AuthServiceConfig{
+			BaseURL: cfg.AuthServiceBaseURL,
+			Token:   cfg.AuthServiceToken,
+		},
+		HostsFile:            cfg.HostsFile,
+		VerifyHostTargets:    cfg.VerifyHostTargets,
+		HostTargetAddresses:  sharing.SplitList(cfg.HostTargetAddresses),
+		HostInfo:             cfg.HostInfo,
+		HostInfoToken:        cfg.HostInfoToken,
+		DNSServers:           sharing.SplitList(cfg.DNSServer),
+		DNSSECPolicy:         dnssecPolicy,
+		DNSSECHostPolicies:   dnssecHostPolicies,
+		ConnectionPool:       sharing.ConnectionPoolConfig(cfg.ConnectionPool),
+		UseQosAndCC:          cfg.UseQosAndCC,
+		ClientTrustedIPsList: cfg.ClientTrustedIPSList,
+		UseClientIPHeaders:   cfg.UseClientIPHeaders,
+	}, nil
+}
+
+func cmdCheckHost(cmd *cobra.Command, args []string) (err error) {
+	ctx, _ := process.Ctx(cmd)
+
+	handlerConfig, err := newHandlerConfig(checkHostCfg)
+	if err != nil {
+		return err
+	}
+
+	report, err := sharing.CheckHost(ctx, handlerConfig, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checking %s\n\n", report.Hostname)
+	for _, check := range report.Checks {
+		fmt.Printf("[%-7s] %s: %s\n", check.Status, check.Name, check.Detail)
+		if check.Fix != "" {
+			fmt.Printf("          fix: %s\n", check.Fix)
+		}
+	}
+	fmt.Println()
+
+	if report.Failed() {
+		return fmt.Errorf("%s is not set up for hosting", report.Hostname)
+	}
+	fmt.Printf("%s is set up for hosting\n", report.Hostname)
+	return nil
+}
+
 func cmdSetup(cmd *cobra.Command, args []string) (err error) {
 	setupDir, err := filepath.Abs(confDir)
 	if err != nil {
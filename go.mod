@@ -18,6 +18,7 @@ require (
 	golang.org/x/crypto v0.0.0-20210415154028-4f45737414dc
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	gopkg.in/webhelp.v1 v1.0.0-20170530084242-3f30213e4c49
+	gopkg.in/yaml.v2 v2.4.0
 	storj.io/common v0.0.0-20210601214904-24681cb3da97
 	storj.io/dotworld v0.0.0-20210324183515-0d11aeccd840
 	storj.io/private v0.0.0-20210615185437-f53a5fcf98e0
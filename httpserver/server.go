@@ -15,6 +15,7 @@ import (
 
 	"github.com/zeebo/errs"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/sync/errgroup"
 
@@ -55,6 +56,16 @@ type TLSConfig struct {
 	KeyFile     string
 	PublicURLs  []string
 	ConfigDir   string
+
+	// ACMEDirectoryURL is the ACME directory used when LetsEncrypt is
+	// enabled. It defaults to the Let's Encrypt production directory.
+	ACMEDirectoryURL string
+
+	// HostPolicy is consulted when LetsEncrypt is enabled and a TLS
+	// handshake is made for a host that isn't one of the PublicURLs. If it
+	// returns nil, a certificate for the host is issued on demand. If unset,
+	// certificates are only issued for the PublicURLs.
+	HostPolicy autocert.HostPolicy
 }
 
 // Server is the HTTP server.
@@ -244,24 +255,48 @@ func configureTLS(config *TLSConfig, handler http.Handler) (*tls.Config, http.Ha
 }
 
 func configureLetsEncrypt(config *TLSConfig, handler http.Handler) (*tls.Config, http.Handler, error) {
-	if len(config.PublicURLs) != 1 {
+	if len(config.PublicURLs) != 1 && config.HostPolicy == nil {
 		return nil, nil, errs.New("cannot do self lets encrypt configuration for multiple hostnames")
 	}
-	parsedURL, err := url.Parse(config.PublicURLs[0])
-	if err != nil {
-		return nil, nil, err
+
+	var publicHosts []string
+	for _, publicURL := range config.PublicURLs {
+		parsedURL, err := url.Parse(publicURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicHosts = append(publicHosts, parsedURL.Host)
 	}
+
 	certManager := autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(parsedURL.Host),
+		HostPolicy: hostPolicy(publicHosts, config.HostPolicy),
 		Cache:      autocert.DirCache(filepath.Join(config.ConfigDir, ".certs")),
 	}
+	if config.ACMEDirectoryURL != "" {
+		certManager.Client = &acme.Client{DirectoryURL: config.ACMEDirectoryURL}
+	}
 
 	tlsConfig := BaseTLSConfig()
 	tlsConfig.GetCertificate = certManager.GetCertificate
 	return tlsConfig, certManager.HTTPHandler(handler), nil
 }
 
+// hostPolicy returns an autocert.HostPolicy that accepts the public hosts and
+// defers to custom, if set, for all other hosts.
+func hostPolicy(publicHosts []string, custom autocert.HostPolicy) autocert.HostPolicy {
+	whitelist := autocert.HostWhitelist(publicHosts...)
+	if custom == nil {
+		return whitelist
+	}
+	return func(ctx context.Context, host string) error {
+		if whitelist(ctx, host) == nil {
+			return nil
+		}
+		return custom(ctx, host)
+	}
+}
+
 func shutdownWithTimeout(server *http.Server, timeout time.Duration) error {
 	if timeout < 0 {
 		return server.Close()
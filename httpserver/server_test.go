@@ -21,6 +21,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
 	"go.uber.org/zap/zaptest"
 
 	"storj.io/common/pkcrypto"
@@ -141,6 +142,24 @@ func TestServer(t *testing.T) {
 	}
 }
 
+func TestHostPolicy(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	policy := hostPolicy([]string{"link.test"}, nil)
+	require.NoError(t, policy(ctx, "link.test"))
+	require.Error(t, policy(ctx, "site.test"))
+
+	policy = hostPolicy([]string{"link.test"}, func(ctx context.Context, host string) error {
+		if host == "site.test" {
+			return nil
+		}
+		return errs.New("unknown host")
+	})
+	require.NoError(t, policy(ctx, "link.test"))
+	require.NoError(t, policy(ctx, "site.test"))
+	require.Error(t, policy(ctx, "other.test"))
+}
+
 type serverTestCase struct {
 	Mapper        *objectmap.IPDB
 	HandlerConfig sharing.Config
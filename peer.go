@@ -24,19 +24,28 @@ type Config struct {
 
 	// Maxmind geolocation database path.
 	GeoLocationDB string
+
+	// OnDemandTLS issues Let's Encrypt certificates for hosted domains on
+	// their first TLS handshake. It requires Server.TLSConfig.LetsEncrypt.
+	OnDemandTLS bool
 }
 
 // Peer is the representation of a Linksharing service itself.
 //
 // architecture: Peer
 type Peer struct {
-	Log    *zap.Logger
-	Mapper *objectmap.IPDB
-	Server *httpserver.Server
+	Log     *zap.Logger
+	Mapper  *objectmap.IPDB
+	Handler *sharing.Handler
+	Server  *httpserver.Server
 }
 
 // New is a constructor for Linksharing Peer.
 func New(log *zap.Logger, config Config) (_ *Peer, err error) {
+	if config.OnDemandTLS && (config.Server.TLSConfig == nil || !config.Server.TLSConfig.LetsEncrypt) {
+		return nil, errs.New("on-demand TLS requires lets-encrypt")
+	}
+
 	peer := &Peer{
 		Log: log,
 	}
@@ -53,6 +62,13 @@ func New(log *zap.Logger, config Config) (_ *Peer, err error) {
 	if err != nil {
 		return nil, errs.New("unable to create handler: %w", err)
 	}
+	peer.Handler = handle
+
+	if config.OnDemandTLS {
+		tlsConfig := *config.Server.TLSConfig
+		tlsConfig.HostPolicy = handle.HostPolicy
+		config.Server.TLSConfig = &tlsConfig
+	}
 
 	peer.Server, err = httpserver.New(log, handle, config.Server)
 	if err != nil {
@@ -71,6 +87,10 @@ func (peer *Peer) Run(ctx context.Context) error {
 		return ignoreCancel(peer.Server.Run(ctx))
 	})
 
+	group.Go(func() error {
+		return ignoreCancel(peer.Handler.Run(ctx))
+	})
+
 	return group.Wait()
 }
 
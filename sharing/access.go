@@ -30,8 +30,7 @@ func parseAccess(ctx context.Context, access string, cfg AuthServiceConfig, clie
 		return parsed, nil
 	}
 
-	// production access grants are base58check encoded with version zero.
-	if _, version, err := base58.CheckDecode(access); err == nil && version == 0 {
+	if isAccessGrant(access) {
 		return wrappedParse(access)
 	}
 
@@ -46,3 +45,11 @@ func parseAccess(ctx context.Context, access string, cfg AuthServiceConfig, clie
 
 	return wrappedParse(authResp.AccessGrant)
 }
+
+// isAccessGrant reports whether access is an encoded access grant rather than
+// an access key id.
+func isAccessGrant(access string) bool {
+	// production access grants are base58check encoded with version zero.
+	_, version, err := base58.CheckDecode(access)
+	return err == nil && version == 0
+}
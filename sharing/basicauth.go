@@ -0,0 +1,140 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// basicAuthVerifiedTTL is how long a verified Authorization header is
+	// accepted without checking its password again.
+	basicAuthVerifiedTTL = 10 * time.Minute
+	// basicAuthVerifiedLimit bounds the number of cached verified
+	// Authorization headers of a site.
+	basicAuthVerifiedLimit = 1024
+)
+
+// basicAuth holds the HTTP Basic credentials of a hosted site. It's parsed
+// again whenever the record of the site is refreshed, so that changed or
+// removed credentials stop working once the record's TTL expires.
+type basicAuth struct {
+	credentials []basicAuthCredential
+	// dummyCost is the bcrypt cost used for users that don't exist, so that
+	// they take as long to reject as wrong passwords.
+	dummyCost int
+
+	// verified caches the digests of Authorization headers that have been
+	// successfully verified, since bcrypt is deliberately slow, together
+	// with when they expire.
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]time.Time
+}
+
+type basicAuthCredential struct {
+	user string
+	hash []byte
+}
+
+// dummyHashes are bcrypt hashes by cost, to compare passwords of users that
+// don't exist with.
+var dummyHashes sync.Map
+
+// dummyHash returns a bcrypt hash with cost.
+func dummyHash(cost int) []byte {
+	if hash, ok := dummyHashes.Load(cost); ok {
+		return hash.([]byte)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("storj-linksharing"), cost)
+	if err != nil {
+		hash, _ = bcrypt.GenerateFromPassword([]byte("storj-linksharing"), bcrypt.DefaultCost)
+	}
+	dummyHashes.Store(cost, hash)
+	return hash
+}
+
+// parseBasicAuth parses entries of the form user:bcrypt-hash, as found in the
+// storj-auth TXT field. It returns nil if there are no entries. Invalid
+// entries are ignored, but as long as there is an entry, authentication is
+// required, so that a mistyped hash doesn't make a site public.
+func parseBasicAuth(entries []string) *basicAuth {
+	if len(entries) == 0 {
+		return nil
+	}
+	auth := &basicAuth{dummyCost: bcrypt.DefaultCost}
+	for _, entry := range entries {
+		fields := strings.SplitN(entry, ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			continue
+		}
+		hash := []byte(fields[1])
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			continue
+		}
+		if len(auth.credentials) == 0 {
+			auth.dummyCost = cost
+		}
+		auth.credentials = append(auth.credentials, basicAuthCredential{
+			user: fields[0],
+			hash: hash,
+		})
+	}
+	return auth
+}
+
+// authorize reports whether the request carries valid credentials.
+func (auth *basicAuth) authorize(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+	now := time.Now()
+	auth.mu.Lock()
+	expiration, ok := auth.verified[digest]
+	auth.mu.Unlock()
+	if ok && now.Before(expiration) {
+		return true
+	}
+
+	var match *basicAuthCredential
+	for i := range auth.credentials {
+		// compare every user to not leak which users exist.
+		if subtle.ConstantTimeCompare([]byte(auth.credentials[i].user), []byte(user)) == 1 {
+			match = &auth.credentials[i]
+		}
+	}
+	if match == nil {
+		// unknown users take as long as wrong passwords, for the same reason.
+		_ = bcrypt.CompareHashAndPassword(dummyHash(auth.dummyCost), []byte(password))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword(match.hash, []byte(password)) != nil {
+		return false
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	if auth.verified == nil || len(auth.verified) >= basicAuthVerifiedLimit {
+		for cached, expiration := range auth.verified {
+			if !now.Before(expiration) {
+				delete(auth.verified, cached)
+			}
+		}
+		if auth.verified == nil || len(auth.verified) >= basicAuthVerifiedLimit {
+			auth.verified = make(map[[sha256.Size]byte]time.Time)
+		}
+	}
+	auth.verified[digest] = now.Add(basicAuthVerifiedTTL)
+	return true
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	require.Nil(t, parseBasicAuth(nil))
+
+	auth := parseBasicAuth([]string{"alice:" + string(hash), "bob:not-a-hash", ":" + string(hash)})
+	require.NotNil(t, auth)
+	require.Len(t, auth.credentials, 1)
+
+	request := func(user, password string) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, "http://site.test/", nil)
+		require.NoError(t, err)
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+		return r
+	}
+
+	assert.False(t, auth.authorize(request("", "")))
+	assert.False(t, auth.authorize(request("alice", "wrong")))
+	assert.False(t, auth.authorize(request("bob", "secret")))
+	assert.True(t, auth.authorize(request("alice", "secret")))
+	// verified credentials are cached.
+	assert.True(t, auth.authorize(request("alice", "secret")))
+	require.Len(t, auth.verified, 1)
+
+	// unknown users are compared with a dummy hash of the same cost.
+	assert.False(t, auth.authorize(request("mallory", "secret")))
+	_, ok := dummyHashes.Load(bcrypt.MinCost)
+	assert.True(t, ok)
+
+	// expired verifications are checked again.
+	for digest := range auth.verified {
+		auth.verified[digest] = time.Now().Add(-time.Second)
+	}
+	assert.True(t, auth.authorize(request("alice", "secret")))
+	for _, expiration := range auth.verified {
+		assert.True(t, expiration.After(time.Now()))
+	}
+
+	// the cache is bounded.
+	auth.verified = make(map[[sha256.Size]byte]time.Time)
+	for i := 0; i < basicAuthVerifiedLimit; i++ {
+		auth.verified[sha256.Sum256([]byte(strconv.Itoa(i)))] = time.Now().Add(time.Minute)
+	}
+	assert.True(t, auth.authorize(request("alice", "secret")))
+	assert.Len(t, auth.verified, 1)
+
+	// invalid entries still require authentication.
+	auth = parseBasicAuth([]string{"bob:not-a-hash"})
+	require.NotNil(t, auth)
+	assert.False(t, auth.authorize(request("bob", "not-a-hash")))
+}
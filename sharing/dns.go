@@ -4,7 +4,16 @@
 package sharing
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
@@ -15,31 +24,194 @@ var (
 	errDNS = errs.Class("dns error")
 )
 
+// dohMediaType is the media type of DNS messages sent over HTTPS.
+const dohMediaType = "application/dns-message"
+
 // DNSClient is a wrapper utility around github.com/miekg/dns to make it
 // a bit more palatable and client user friendly.
 type DNSClient struct {
-	c         *dns.Client
-	dnsServer string
+	servers []*dnsServer
 }
 
-// NewDNSClient creates a DNS Client that uses the given
-// dnsServerAddr. Currently requires that the DNS Server speaks TCP.
-func NewDNSClient(dnsServerAddr string) (*DNSClient, error) {
-	return &DNSClient{
-		c:         &dns.Client{Net: "tcp"},
-		dnsServer: dnsServerAddr,
-	}, nil
+// NewDNSClient creates a DNS Client that uses the given dnsServerAddrs. Each
+// address selects the transport used for that server:
+//     * host:port or tcp://host:port uses plain DNS over TCP.
+//     * udp://host:port uses plain DNS over UDP, retrying over TCP when a
+//       response is truncated.
+//     * tls://host:port or tcp-tls://host:port uses DNS over TLS.
+//     * https://host/path uses DNS over HTTPS (RFC 8484).
+// If the port is missing, the default port of the transport is used. Empty
+// addresses are ignored. When there is more than one server, lookups go to
+// the healthiest server and fail over to the others, see
+// exchangeWithFailover.
+func NewDNSClient(dnsServerAddrs ...string) (*DNSClient, error) {
+	cli := &DNSClient{}
+	for _, addr := range dnsServerAddrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		transport, err := newDNSTransport(addr)
+		if err != nil {
+			return nil, err
+		}
+		cli.servers = append(cli.servers, &dnsServer{addr: addr, transport: transport})
+	}
+	return cli, nil
 }
 
 // Lookup is a helper method that never returns truncated DNS messages.
-// The current implementation does this by doing all lookups over TCP.
 func (cli *DNSClient) Lookup(ctx context.Context, host string, recordType uint16) (*dns.Msg, error) {
 	m := dns.Msg{}
 	m.SetQuestion(dns.Fqdn(host), recordType)
-	r, _, err := cli.c.ExchangeContext(ctx, &m, cli.dnsServer)
+	r, err := exchangeWithFailover(ctx, cli.servers, &m)
 	return r, errDNS.Wrap(err)
 }
 
+// LookupDNSSEC is like Lookup, but sets the DNSSEC OK bit to request the
+// RRSIG records needed for validating the response.
+func (cli *DNSClient) LookupDNSSEC(ctx context.Context, host string, recordType uint16) (*dns.Msg, error) {
+	m := dns.Msg{}
+	m.SetQuestion(dns.Fqdn(host), recordType)
+	m.SetEdns0(4096, true)
+	r, err := exchangeWithFailover(ctx, cli.servers, &m)
+	return r, errDNS.Wrap(err)
+}
+
+// dnsTransport exchanges DNS messages with a server.
+type dnsTransport interface {
+	exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+}
+
+// newDNSTransport returns the transport for the server address, see
+// NewDNSClient.
+func newDNSTransport(server string) (dnsTransport, error) {
+	if !strings.Contains(server, "://") {
+		// backcompat: a plain address is spoken to over TCP.
+		return &streamTransport{client: &dns.Client{Net: "tcp"}, addr: server}, nil
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, errDNS.Wrap(err)
+	}
+	if u.Host == "" {
+		return nil, errDNS.New("dns server %q must contain a host", server)
+	}
+
+	withPort := func(defaultPort string) string {
+		if u.Port() != "" {
+			return u.Host
+		}
+		return net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		return &streamTransport{client: &dns.Client{Net: "tcp"}, addr: withPort("53")}, nil
+	case "udp":
+		return &udpTransport{
+			udp:  &dns.Client{Net: "udp", UDPSize: dns.DefaultMsgSize},
+			tcp:  &dns.Client{Net: "tcp"},
+			addr: withPort("53"),
+		}, nil
+	case "tls", "tcp-tls":
+		return &streamTransport{
+			client: &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{
+				ServerName: u.Hostname(),
+				MinVersion: tls.VersionTLS12,
+			}},
+			addr: withPort("853"),
+		}, nil
+	case "https":
+		return &httpsTransport{client: &http.Client{Timeout: 10 * time.Second}, url: u.String()}, nil
+	default:
+		return nil, errDNS.New("unsupported dns server scheme %q", u.Scheme)
+	}
+}
+
+// streamTransport speaks DNS over TCP or TLS, where responses are never
+// truncated.
+type streamTransport struct {
+	client *dns.Client
+	addr   string
+}
+
+func (t *streamTransport) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	r, _, err := t.client.ExchangeContext(ctx, m, t.addr)
+	return r, err
+}
+
+// udpTransport speaks DNS over UDP and retries over TCP when a response is
+// truncated.
+type udpTransport struct {
+	udp  *dns.Client
+	tcp  *dns.Client
+	addr string
+}
+
+func (t *udpTransport) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if m.IsEdns0() == nil {
+		// advertise a larger buffer to avoid truncation where possible.
+		m.SetEdns0(dns.DefaultMsgSize, false)
+	}
+	r, _, err := t.udp.ExchangeContext(ctx, m, t.addr)
+	if errors.Is(err, dns.ErrTruncated) || (err == nil && r.Truncated) {
+		mon.Event("dns_udp_truncated")
+		r, _, err = t.tcp.ExchangeContext(ctx, m, t.addr)
+	}
+	return r, err
+}
+
+// httpsTransport speaks DNS over HTTPS as described in RFC 8484.
+type httpsTransport struct {
+	client *http.Client
+	url    string
+}
+
+func (t *httpsTransport) exchange(ctx context.Context, m *dns.Msg) (_ *dns.Msg, err error) {
+	// the id should be zero to make responses cacheable by http caches.
+	query := m.Copy()
+	query.Id = 0
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errs.Combine(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errs.New("dns server returned http status %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != dohMediaType {
+		return nil, errs.New("dns server returned unexpected content type %q", contentType)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, err
+	}
+	r.Id = m.Id
+	return r, nil
+}
+
 // ResponseToTXTRecordSet returns a TXTRecordSet from a dns Lookup response.
 func ResponseToTXTRecordSet(resp *dns.Msg) *TXTRecordSet {
 	set := NewTXTRecordSet()
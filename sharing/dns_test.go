@@ -0,0 +1,142 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+func TestNewDNSTransport(t *testing.T) {
+	for _, test := range []struct {
+		server    string
+		transport dnsTransport
+	}{
+		{"1.1.1.1:53", &streamTransport{addr: "1.1.1.1:53"}},
+		{"tcp://1.1.1.1", &streamTransport{addr: "1.1.1.1:53"}},
+		{"udp://1.1.1.1:5353", &udpTransport{addr: "1.1.1.1:5353"}},
+		{"tls://1.1.1.1", &streamTransport{addr: "1.1.1.1:853"}},
+		{"tcp-tls://[::1]:8853", &streamTransport{addr: "[::1]:8853"}},
+		{"https://1.1.1.1/dns-query", &httpsTransport{url: "https://1.1.1.1/dns-query"}},
+	} {
+		transport, err := newDNSTransport(test.server)
+		require.NoError(t, err, test.server)
+		require.IsType(t, test.transport, transport, test.server)
+		switch expected := test.transport.(type) {
+		case *streamTransport:
+			require.Equal(t, expected.addr, transport.(*streamTransport).addr, test.server)
+		case *udpTransport:
+			require.Equal(t, expected.addr, transport.(*udpTransport).addr, test.server)
+		case *httpsTransport:
+			require.Equal(t, expected.url, transport.(*httpsTransport).url, test.server)
+		}
+	}
+
+	_, err := newDNSTransport("quic://1.1.1.1")
+	require.Error(t, err)
+	_, err = newDNSTransport("udp://")
+	require.Error(t, err)
+}
+
+func TestNewDNSClient(t *testing.T) {
+	client, err := NewDNSClient(" 1.1.1.1:53", "", "udp://8.8.8.8:53 ")
+	require.NoError(t, err)
+	require.Len(t, client.servers, 2)
+	require.Equal(t, "1.1.1.1:53", client.servers[0].addr)
+	require.Equal(t, "udp://8.8.8.8:53", client.servers[1].addr)
+
+	// the deprecated DNSServer is a comma separated list.
+	config := Config{DNSServer: "1.1.1.1:53, 8.8.8.8:53"}
+	require.Equal(t, []string{"1.1.1.1:53", "8.8.8.8:53"}, config.dnsServers())
+	config.DNSServers = []string{"9.9.9.9:53"}
+	require.Equal(t, []string{"9.9.9.9:53"}, config.dnsServers())
+}
+
+func testTXTResponse(req *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = append(resp.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: []string{"storj-root:bucket"},
+	})
+	return resp
+}
+
+func TestDNSClientUDPRetriesTruncated(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	var udpQueries, tcpQueries int64
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := testTXTResponse(req)
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			atomic.AddInt64(&udpQueries, 1)
+			resp.Answer = nil
+			resp.Truncated = true
+		} else {
+			atomic.AddInt64(&tcpQueries, 1)
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	require.NoError(t, err)
+
+	udpServer := &dns.Server{PacketConn: packetConn, Handler: handler}
+	tcpServer := &dns.Server{Listener: listener, Handler: handler}
+	ctx.Go(udpServer.ActivateAndServe)
+	ctx.Go(tcpServer.ActivateAndServe)
+	defer ctx.Check(udpServer.Shutdown)
+	defer ctx.Check(tcpServer.Shutdown)
+
+	client, err := NewDNSClient("udp://" + packetConn.LocalAddr().String())
+	require.NoError(t, err)
+
+	resp, err := client.Lookup(ctx, "txt-site.test", dns.TypeTXT)
+	require.NoError(t, err)
+	require.False(t, resp.Truncated)
+	require.Equal(t, "bucket", ResponseToTXTRecordSet(resp).Lookup("storj-root"))
+	require.EqualValues(t, 1, atomic.LoadInt64(&udpQueries))
+	require.EqualValues(t, 1, atomic.LoadInt64(&tcpQueries))
+}
+
+func TestDNSClientHTTPS(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, dohMediaType, r.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := new(dns.Msg)
+		require.NoError(t, req.Unpack(body))
+		require.Zero(t, req.Id)
+
+		packed, err := testTXTResponse(req).Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", dohMediaType)
+		_, err = w.Write(packed)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	client, err := NewDNSClient(server.URL + "/dns-query")
+	require.NoError(t, err)
+	client.servers[0].transport.(*httpsTransport).client = server.Client()
+
+	resp, err := client.Lookup(ctx, "txt-site.test", dns.TypeTXT)
+	require.NoError(t, err)
+	require.Equal(t, "bucket", ResponseToTXTRecordSet(resp).Lookup("storj-root"))
+}
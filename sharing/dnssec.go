@@ -0,0 +1,338 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/zeebo/errs"
+)
+
+// DNSSECPolicy determines whether the TXT records of a hosted domain must be
+// signed with DNSSEC.
+type DNSSECPolicy string
+
+const (
+	// DNSSECOff doesn't request or validate DNSSEC signatures.
+	DNSSECOff DNSSECPolicy = "off"
+	// DNSSECPrefer validates DNSSEC signatures when the records are signed
+	// and accepts unsigned records. It's opportunistic only: it rejects bad
+	// signatures, but whether a zone is signed is decided from the response
+	// itself, so an on-path attacker can strip the signatures of a forged
+	// response to have it accepted. Only DNSSECRequire protects against
+	// spoofed records.
+	DNSSECPrefer DNSSECPolicy = "prefer"
+	// DNSSECRequire only accepts records with valid DNSSEC signatures.
+	DNSSECRequire DNSSECPolicy = "require"
+)
+
+// ParseDNSSECPolicy parses a DNSSEC policy. The empty string is off.
+func ParseDNSSECPolicy(s string) (DNSSECPolicy, error) {
+	switch policy := DNSSECPolicy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case "":
+		return DNSSECOff, nil
+	case DNSSECOff, DNSSECPrefer, DNSSECRequire:
+		return policy, nil
+	default:
+		return "", errs.New("invalid dnssec policy %q", s)
+	}
+}
+
+// ParseDNSSECHostPolicies parses a comma separated list of host=policy pairs.
+func ParseDNSSECHostPolicies(s string) (map[string]DNSSECPolicy, error) {
+	policies := map[string]DNSSECPolicy{}
+	for _, entry := range SplitList(s) {
+		fields := strings.SplitN(entry, "=", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" {
+			return nil, errs.New("invalid dnssec host policy %q", entry)
+		}
+		policy, err := ParseDNSSECPolicy(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		policies[strings.TrimSpace(fields[0])] = policy
+	}
+	return policies, nil
+}
+
+// dnssecPolicies holds the DNSSEC policy for hosted domains.
+type dnssecPolicies struct {
+	defaultPolicy DNSSECPolicy
+	hosts         map[string]DNSSECPolicy
+}
+
+// lookup returns the policy for host, which is the policy of the host itself
+// or of its closest parent domain, falling back to the default policy.
+func (policies dnssecPolicies) lookup(host string) DNSSECPolicy {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for {
+		if policy, ok := policies.hosts[host]; ok {
+			return policy
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	if policies.defaultPolicy == "" {
+		return DNSSECOff
+	}
+	return policies.defaultPolicy
+}
+
+// enabled reports whether any host may need DNSSEC validation.
+func (policies dnssecPolicies) enabled() bool {
+	if policies.defaultPolicy != "" && policies.defaultPolicy != DNSSECOff {
+		return true
+	}
+	for _, policy := range policies.hosts {
+		if policy != DNSSECOff {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errDNSSEC = errs.Class("dnssec error")
+
+	// errDNSSECUnsigned is returned when a response has no signatures at
+	// all, which DNSSECPrefer accepts without proof that the zone is
+	// unsigned.
+	errDNSSECUnsigned = errDNSSEC.New("response is not signed")
+)
+
+// rootTrustAnchors are the DS records of the root zone key signing keys, as
+// published at https://data.iana.org/root-anchors/root-anchors.xml.
+var rootTrustAnchors = []*dns.DS{
+	{
+		Hdr:        dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET},
+		KeyTag:     20326,
+		Algorithm:  dns.RSASHA256,
+		DigestType: dns.SHA256,
+		Digest:     "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	},
+	{
+		Hdr:        dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET},
+		KeyTag:     38696,
+		Algorithm:  dns.RSASHA256,
+		DigestType: dns.SHA256,
+		Digest:     "683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+	},
+}
+
+// dnssecValidator validates the chain of trust of DNS responses from their
+// signatures up to the root trust anchors.
+type dnssecValidator struct {
+	lookup  func(ctx context.Context, host string, recordType uint16) (*dns.Msg, error)
+	anchors []*dns.DS
+	now     func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]zoneKeys
+}
+
+// zoneKeys are the validated keys of a zone.
+type zoneKeys struct {
+	keys       []*dns.DNSKEY
+	expiration time.Time
+}
+
+// newDNSSECValidator returns a validator that uses the dns client for looking
+// up keys and delegations.
+func newDNSSECValidator(client *DNSClient) *dnssecValidator {
+	return &dnssecValidator{
+		lookup:  client.LookupDNSSEC,
+		anchors: rootTrustAnchors,
+		now:     time.Now,
+		keys:    map[string]zoneKeys{},
+	}
+}
+
+// validate checks that every RRset in the answer section of resp carries a
+// valid signature chaining up to a trust anchor. It returns
+// errDNSSECUnsigned if the answer has no signatures at all.
+func (v *dnssecValidator) validate(ctx context.Context, resp *dns.Msg) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	rrsets, sigs := splitRRsets(resp.Answer)
+	if len(sigs) == 0 {
+		return errDNSSECUnsigned
+	}
+	if len(rrsets) == 0 {
+		return errDNSSEC.New("empty answer")
+	}
+	for _, rrset := range rrsets {
+		if err := v.verifyRRset(ctx, rrset, sigs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyRRset checks that one of the signatures covering rrset is valid and
+// made by a validated key of the signer zone.
+func (v *dnssecValidator) verifyRRset(ctx context.Context, rrset []dns.RR, sigs []*dns.RRSIG) error {
+	header := rrset[0].Header()
+	var keysErr error
+	for _, sig := range sigs {
+		if sig.TypeCovered != header.Rrtype || !strings.EqualFold(sig.Hdr.Name, header.Name) {
+			continue
+		}
+		// the signer must be the zone of the owner name or one of its
+		// parents, and DS records are signed by the parent zone.
+		if !dns.IsSubDomain(sig.SignerName, header.Name) {
+			continue
+		}
+		if header.Rrtype == dns.TypeDS && strings.EqualFold(sig.SignerName, header.Name) {
+			continue
+		}
+		if !sig.ValidityPeriod(v.now()) {
+			continue
+		}
+
+		keys, err := v.zoneKeys(ctx, sig.SignerName)
+		if err != nil {
+			keysErr = err
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() == sig.KeyTag && sig.Verify(key, rrset) == nil {
+				return nil
+			}
+		}
+	}
+	if keysErr != nil {
+		return keysErr
+	}
+	return errDNSSEC.New("no valid signature for %s %s", header.Name, dns.TypeToString[header.Rrtype])
+}
+
+// zoneKeys returns the DNSKEYs of zone after validating them against the DS
+// records of the parent zone, or the trust anchors for the root zone.
+func (v *dnssecValidator) zoneKeys(ctx context.Context, zone string) (_ []*dns.DNSKEY, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	zone = strings.ToLower(dns.Fqdn(zone))
+
+	v.mu.Lock()
+	cached, ok := v.keys[zone]
+	v.mu.Unlock()
+	if ok && cached.expiration.After(v.now()) {
+		return cached.keys, nil
+	}
+
+	var trusted []*dns.DS
+	if zone == "." {
+		trusted = v.anchors
+	} else {
+		resp, err := v.lookup(ctx, zone, dns.TypeDS)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.verifyRRsetOf(ctx, resp, zone, dns.TypeDS); err != nil {
+			return nil, err
+		}
+		for _, rr := range resp.Answer {
+			if ds, ok := rr.(*dns.DS); ok {
+				trusted = append(trusted, ds)
+			}
+		}
+	}
+
+	resp, err := v.lookup(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	rrsets, sigs := splitRRsets(resp.Answer)
+
+	var keySet []dns.RR
+	for _, rrset := range rrsets {
+		if rrset[0].Header().Rrtype == dns.TypeDNSKEY && strings.EqualFold(rrset[0].Header().Name, zone) {
+			keySet = rrset
+		}
+	}
+	if keySet == nil {
+		return nil, errDNSSEC.New("no keys for zone %q", zone)
+	}
+
+	// the key set must be signed by a key matching a trusted DS record.
+	for _, sig := range sigs {
+		if sig.TypeCovered != dns.TypeDNSKEY || !sig.ValidityPeriod(v.now()) {
+			continue
+		}
+		for _, rr := range keySet {
+			key := rr.(*dns.DNSKEY)
+			if key.KeyTag() != sig.KeyTag || !matchesDS(key, trusted) {
+				continue
+			}
+			if sig.Verify(key, keySet) != nil {
+				continue
+			}
+
+			keys := make([]*dns.DNSKEY, 0, len(keySet))
+			for _, rr := range keySet {
+				keys = append(keys, rr.(*dns.DNSKEY))
+			}
+
+			ttl := time.Duration(keySet[0].Header().Ttl) * time.Second
+			v.mu.Lock()
+			v.keys[zone] = zoneKeys{keys: keys, expiration: v.now().Add(ttl)}
+			v.mu.Unlock()
+			return keys, nil
+		}
+	}
+	return nil, errDNSSEC.New("no trusted keys for zone %q", zone)
+}
+
+// verifyRRsetOf verifies the RRset of the given name and type in resp.
+func (v *dnssecValidator) verifyRRsetOf(ctx context.Context, resp *dns.Msg, name string, recordType uint16) error {
+	rrsets, sigs := splitRRsets(resp.Answer)
+	for _, rrset := range rrsets {
+		header := rrset[0].Header()
+		if header.Rrtype == recordType && strings.EqualFold(header.Name, name) {
+			return v.verifyRRset(ctx, rrset, sigs)
+		}
+	}
+	return errDNSSEC.New("no %s records for %q", dns.TypeToString[recordType], name)
+}
+
+// matchesDS reports whether key matches one of the DS records.
+func matchesDS(key *dns.DNSKEY, trusted []*dns.DS) bool {
+	for _, ds := range trusted {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRRsets groups the records by name and type and separates the
+// signatures.
+func splitRRsets(rrs []dns.RR) (rrsets [][]dns.RR, sigs []*dns.RRSIG) {
+	index := map[string]int{}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+			continue
+		}
+		header := rr.Header()
+		key := strings.ToLower(header.Name) + "/" + dns.TypeToString[header.Rrtype]
+		if i, ok := index[key]; ok {
+			rrsets[i] = append(rrsets[i], rr)
+			continue
+		}
+		index[key] = len(rrsets)
+		rrsets = append(rrsets, []dns.RR{rr})
+	}
+	return rrsets, sigs
+}
@@ -0,0 +1,201 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+// testZone is a DNSSEC signed zone for testing.
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+func (zone *testZone) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+		KeyTag:     zone.key.KeyTag(),
+		SignerName: zone.name,
+		Algorithm:  zone.key.Algorithm,
+	}
+	require.NoError(t, sig.Sign(zone.priv, rrset))
+	return append(append([]dns.RR{}, rrset...), sig)
+}
+
+func TestDNSSECValidator(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	root := newTestZone(t, ".")
+	tld := newTestZone(t, "test.")
+	evil := newTestZone(t, "test.")
+
+	txt := func(value string) dns.RR {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: "txt-site.test.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{value},
+		}
+	}
+	tldDS := tld.key.ToDS(dns.SHA256)
+	tldDS.Hdr = dns.RR_Header{Name: "test.", Rrtype: dns.TypeDS, Class: dns.ClassINET, Ttl: 3600}
+
+	responses := map[string][]dns.RR{
+		".|DNSKEY":     root.sign(t, root.key),
+		"test.|DS":     root.sign(t, tldDS),
+		"test.|DNSKEY": tld.sign(t, tld.key),
+	}
+
+	anchor := root.key.ToDS(dns.SHA256)
+	validator := &dnssecValidator{
+		lookup: func(ctx context.Context, host string, recordType uint16) (*dns.Msg, error) {
+			return &dns.Msg{Answer: responses[host+"|"+dns.TypeToString[recordType]]}, nil
+		},
+		anchors: []*dns.DS{anchor},
+		now:     time.Now,
+		keys:    map[string]zoneKeys{},
+	}
+
+	// a correctly signed answer validates.
+	require.NoError(t, validator.validate(ctx, &dns.Msg{Answer: tld.sign(t, txt("storj-root:bucket"))}))
+
+	// an unsigned answer is reported as such.
+	err := validator.validate(ctx, &dns.Msg{Answer: []dns.RR{txt("storj-root:bucket")}})
+	require.True(t, errors.Is(err, errDNSSECUnsigned))
+
+	// a tampered answer doesn't validate.
+	signed := tld.sign(t, txt("storj-root:bucket"))
+	signed[0] = txt("storj-root:evil")
+	require.Error(t, validator.validate(ctx, &dns.Msg{Answer: signed}))
+
+	// an answer signed by a key that isn't in the chain of trust doesn't
+	// validate.
+	responses["test.|DNSKEY"] = evil.sign(t, evil.key)
+	validator.keys = map[string]zoneKeys{}
+	require.Error(t, validator.validate(ctx, &dns.Msg{Answer: evil.sign(t, txt("storj-root:evil"))}))
+}
+
+func TestDNSSECPolicies(t *testing.T) {
+	_, err := ParseDNSSECPolicy("sometimes")
+	require.Error(t, err)
+
+	hosts, err := ParseDNSSECHostPolicies("example.test=require, www.example.test=off")
+	require.NoError(t, err)
+
+	policies := dnssecPolicies{defaultPolicy: DNSSECPrefer, hosts: hosts}
+	require.True(t, policies.enabled())
+	require.Equal(t, DNSSECRequire, policies.lookup("example.test"))
+	require.Equal(t, DNSSECRequire, policies.lookup("docs.example.test"))
+	require.Equal(t, DNSSECOff, policies.lookup("www.example.test"))
+	require.Equal(t, DNSSECPrefer, policies.lookup("other.test"))
+
+	require.False(t, dnssecPolicies{}.enabled())
+	require.Equal(t, DNSSECOff, dnssecPolicies{}.lookup("example.test"))
+}
+
+func TestDNSSECRequireOnlyValidatesHostingRecords(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	root := newTestZone(t, ".")
+	tld := newTestZone(t, "test.")
+	tldDS := tld.key.ToDS(dns.SHA256)
+	tldDS.Hdr = dns.RR_Header{Name: "test.", Rrtype: dns.TypeDS, Class: dns.ClassINET, Ttl: 3600}
+
+	serializedAccess := newTestAccess(t)
+	txt := func(name string) []dns.RR {
+		// signed strings can't exceed 255 bytes, so the access is split.
+		fields := []string{"storj-root:bucket"}
+		for i := 0; i*200 < len(serializedAccess); i++ {
+			end := (i + 1) * 200
+			if end > len(serializedAccess) {
+				end = len(serializedAccess)
+			}
+			fields = append(fields, fmt.Sprintf("storj-access-%d:%s", i+1, serializedAccess[i*200:end]))
+		}
+		var rrs []dns.RR
+		for _, field := range fields {
+			rrs = append(rrs, &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{field},
+			})
+		}
+		return rrs
+	}
+	answers := map[string][]dns.RR{
+		"_storj.apex.test.":   tld.sign(t, txt("_storj.apex.test.")...),
+		"_storj.forged.test.": txt("_storj.forged.test."),
+	}
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		answer, ok := answers[m.Question[0].Name]
+		if !ok {
+			// unsigned, as a denial without its NSEC records.
+			r.Rcode = dns.RcodeNameError
+			return r, nil
+		}
+		r.Answer = answer
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{
+		maxTTL: time.Hour,
+		dnssec: dnssecPolicies{defaultPolicy: DNSSECRequire},
+	}, &DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+	responses := map[string][]dns.RR{
+		".|DNSKEY":     root.sign(t, root.key),
+		"test.|DS":     root.sign(t, tldDS),
+		"test.|DNSKEY": tld.sign(t, tld.key),
+	}
+	records.dnssecValidator = &dnssecValidator{
+		lookup: func(ctx context.Context, host string, recordType uint16) (*dns.Msg, error) {
+			return &dns.Msg{Answer: responses[host+"|"+dns.TypeToString[recordType]]}, nil
+		},
+		anchors: []*dns.DS{root.key.ToDS(dns.SHA256)},
+		now:     time.Now,
+		keys:    map[string]zoneKeys{},
+	}
+
+	// the missing txt-apex.test doesn't keep the signed _storj.apex.test from
+	// being used.
+	record, err := records.queryAccessFromDNS(ctx, "apex.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "bucket", record.site.root)
+
+	// unsigned records that set up hosting are rejected.
+	_, err = records.queryAccessFromDNS(ctx, "forged.test", "")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, GetStatus(err, 0))
+
+	// and hostnames without records aren't set up, which is cached
+	// negatively.
+	_, err = records.queryAccessFromDNS(ctx, "unknown.test", "")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, GetStatus(err, 0))
+}
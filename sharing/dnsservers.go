@@ -0,0 +1,196 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/zeebo/errs"
+)
+
+const (
+	// dnsEjectAfter is the number of consecutive failures after which a
+	// server is ejected.
+	dnsEjectAfter = 3
+	// dnsEjectDuration is how long an ejected server is only used as a last
+	// resort.
+	dnsEjectDuration = 30 * time.Second
+	// dnsMinHedgeDelay and dnsMaxHedgeDelay bound how long to wait for a
+	// server before racing the next one.
+	dnsMinHedgeDelay = 100 * time.Millisecond
+	dnsMaxHedgeDelay = time.Second
+	// dnsDecay is the weight of the newest sample in the moving averages.
+	dnsDecay = 0.2
+)
+
+// dnsServer is an upstream DNS server together with its health.
+type dnsServer struct {
+	addr      string
+	transport dnsTransport
+
+	mu           sync.Mutex
+	latency      time.Duration // moving average of successful exchanges
+	errorRate    float64       // moving average of failures, from 0 to 1
+	failures     int           // consecutive failures
+	ejectedUntil time.Time
+}
+
+// exchange exchanges m with the server and records the outcome. Outcomes
+// caused by canceling ctx are not held against the server.
+func (server *dnsServer) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	start := time.Now()
+	r, err := server.transport.exchange(ctx, m)
+	if ctx.Err() == nil {
+		server.record(time.Since(start), err == nil && !isServerFailure(r), start)
+	}
+	return r, err
+}
+
+// record updates the health of the server.
+func (server *dnsServer) record(rtt time.Duration, ok bool, now time.Time) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	tag := monkit.NewSeriesTag("server", server.addr)
+	if ok {
+		mon.DurationVal("dns_server_latency", tag).Observe(rtt)
+		if server.latency == 0 {
+			server.latency = rtt
+		} else {
+			server.latency += time.Duration(dnsDecay * float64(rtt-server.latency))
+		}
+		server.errorRate -= dnsDecay * server.errorRate
+		server.failures = 0
+		return
+	}
+
+	mon.Counter("dns_server_failure", tag).Inc(1)
+	server.errorRate += dnsDecay * (1 - server.errorRate)
+	server.failures++
+	if server.failures >= dnsEjectAfter {
+		mon.Event("dns_server_ejected", tag)
+		server.ejectedUntil = now.Add(dnsEjectDuration)
+		server.failures = 0
+	}
+}
+
+// health returns the state of the server used for ordering servers.
+func (server *dnsServer) health(now time.Time) (ejected bool, cost float64, hedgeDelay time.Duration) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	hedgeDelay = 2 * server.latency
+	if hedgeDelay < dnsMinHedgeDelay {
+		hedgeDelay = dnsMinHedgeDelay
+	}
+	if hedgeDelay > dnsMaxHedgeDelay {
+		hedgeDelay = dnsMaxHedgeDelay
+	}
+	// a server that fails half of the time is as good as one that is three
+	// times as slow. Servers without samples are assumed to be fast.
+	cost = float64(server.latency+dnsMinHedgeDelay) * (1 + 4*server.errorRate)
+	return now.Before(server.ejectedUntil), cost, hedgeDelay
+}
+
+// isServerFailure reports whether the response indicates a problem with the
+// server rather than an answer to the question.
+func isServerFailure(r *dns.Msg) bool {
+	return r == nil || r.Rcode == dns.RcodeServerFailure || r.Rcode == dns.RcodeRefused
+}
+
+// orderServers returns the servers ordered from the healthiest to the least
+// healthy, with ejected servers last. Servers that are equally healthy keep
+// their configured order.
+func orderServers(servers []*dnsServer, now time.Time) (ordered []*dnsServer, hedgeDelays []time.Duration) {
+	type entry struct {
+		server     *dnsServer
+		ejected    bool
+		cost       float64
+		hedgeDelay time.Duration
+	}
+	entries := make([]entry, 0, len(servers))
+	for _, server := range servers {
+		ejected, cost, hedgeDelay := server.health(now)
+		entries = append(entries, entry{server: server, ejected: ejected, cost: cost, hedgeDelay: hedgeDelay})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ejected != entries[j].ejected {
+			return !entries[i].ejected
+		}
+		return entries[i].cost < entries[j].cost
+	})
+	for _, entry := range entries {
+		ordered = append(ordered, entry.server)
+		hedgeDelays = append(hedgeDelays, entry.hedgeDelay)
+	}
+	return ordered, hedgeDelays
+}
+
+// exchangeWithFailover sends m to the healthiest server. If it fails, the next
+// one is tried, and if it doesn't answer within its hedge delay, the next one
+// is raced against it. The first successful response wins. If every server
+// fails, the last response or error is returned.
+func exchangeWithFailover(ctx context.Context, servers []*dnsServer, m *dns.Msg) (_ *dns.Msg, err error) {
+	ordered, hedgeDelays := orderServers(servers, time.Now())
+	switch len(ordered) {
+	case 0:
+		return nil, errs.New("no dns servers configured")
+	case 1:
+		return ordered[0].exchange(ctx, m)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		r   *dns.Msg
+		err error
+	}
+	results := make(chan result, len(ordered))
+
+	next := 0
+	var hedge <-chan time.Time
+	start := func() {
+		server := ordered[next]
+		hedge = time.After(hedgeDelays[next])
+		next++
+		go func() {
+			r, err := server.exchange(ctx, m.Copy())
+			results <- result{r: r, err: err}
+		}()
+	}
+
+	start()
+	inflight := 1
+
+	var last result
+	for inflight > 0 {
+		select {
+		case res := <-results:
+			inflight--
+			if res.err == nil && !isServerFailure(res.r) {
+				return res.r, nil
+			}
+			last = res
+			if next < len(ordered) {
+				start()
+				inflight++
+			}
+		case <-hedge:
+			if next < len(ordered) {
+				mon.Event("dns_server_hedged")
+				start()
+				inflight++
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return last.r, last.err
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"storj.io/common/testcontext"
+)
+
+// fakeTransport answers queries with a fixed delay and outcome.
+type fakeTransport struct {
+	delay   time.Duration
+	rcode   int
+	err     error
+	queries int64
+}
+
+func (transport *fakeTransport) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	atomic.AddInt64(&transport.queries, 1)
+	select {
+	case <-time.After(transport.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if transport.err != nil {
+		return nil, transport.err
+	}
+	r := testTXTResponse(m)
+	r.Rcode = transport.rcode
+	return r, nil
+}
+
+func TestExchangeWithFailover(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	query := func(servers ...*dnsServer) (*dns.Msg, error) {
+		m := dns.Msg{}
+		m.SetQuestion("txt-site.test.", dns.TypeTXT)
+		return exchangeWithFailover(ctx, servers, &m)
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		broken := &fakeTransport{err: errs.New("connection refused")}
+		refusing := &fakeTransport{rcode: dns.RcodeRefused}
+		working := &fakeTransport{}
+		servers := []*dnsServer{
+			{addr: "broken", transport: broken},
+			{addr: "refusing", transport: refusing},
+			{addr: "working", transport: working},
+		}
+
+		r, err := query(servers...)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeSuccess, r.Rcode)
+		require.EqualValues(t, 1, atomic.LoadInt64(&broken.queries))
+		require.EqualValues(t, 1, atomic.LoadInt64(&refusing.queries))
+		require.EqualValues(t, 1, atomic.LoadInt64(&working.queries))
+
+		// the working server is preferred once it has proven itself.
+		ordered, _ := orderServers(servers, time.Now())
+		require.Equal(t, "working", ordered[0].addr)
+	})
+
+	t.Run("ejection", func(t *testing.T) {
+		broken := &fakeTransport{err: errs.New("connection refused")}
+		working := &fakeTransport{}
+		servers := []*dnsServer{
+			{addr: "broken", transport: broken},
+			{addr: "working", transport: working},
+		}
+
+		for i := 0; i < dnsEjectAfter; i++ {
+			_, err := query(servers[0])
+			require.Error(t, err)
+		}
+		ordered, _ := orderServers(servers, time.Now())
+		require.Equal(t, "working", ordered[0].addr)
+		ordered, _ = orderServers(servers, time.Now().Add(dnsEjectDuration))
+		require.Equal(t, "broken", ordered[1].addr)
+
+		// all servers failing returns the last error.
+		working.err = errs.New("timeout")
+		_, err := query(servers...)
+		require.Error(t, err)
+	})
+
+	t.Run("hedging", func(t *testing.T) {
+		slow := &fakeTransport{delay: time.Minute}
+		fast := &fakeTransport{}
+		servers := []*dnsServer{
+			{addr: "slow", transport: slow},
+			{addr: "fast", transport: fast},
+		}
+
+		start := time.Now()
+		_, err := query(servers...)
+		require.NoError(t, err)
+		require.Less(t, int64(time.Since(start)), int64(10*time.Second))
+		require.EqualValues(t, 1, atomic.LoadInt64(&slow.queries))
+		require.EqualValues(t, 1, atomic.LoadInt64(&fast.queries))
+	})
+
+	t.Run("no servers", func(t *testing.T) {
+		_, err := query()
+		require.Error(t, err)
+	})
+}
@@ -12,6 +12,8 @@ type errSym int
 const (
 	errAction     errSym = 1
 	errStatusCode errSym = 2
+	errErrorPages errSym = 3
+	errHandled    errSym = 4
 )
 
 // httpStatusClientClosedRequest is used when the client closes the request without
@@ -30,6 +32,32 @@ func WithStatus(err error, statusCode int) error {
 	return errdata.Annotate(err, errStatusCode, statusCode)
 }
 
+// withErrorPages annotates an error with the custom error pages of the
+// hosted site it happened on. If err is nil, does nothing.
+func withErrorPages(err error, pages *errorPages) error {
+	return errdata.Annotate(err, errErrorPages, pages)
+}
+
+// getErrorPages returns the most recent error pages annotation on the error,
+// or nil if none is found.
+func getErrorPages(err error) *errorPages {
+	pages, _ := errdata.Value(err, errErrorPages).(*errorPages)
+	return pages
+}
+
+// withHandled annotates an error whose response was already written, so that
+// it's still reported as the error of the request, but not handled again. If
+// err is nil, does nothing.
+func withHandled(err error) error {
+	return errdata.Annotate(err, errHandled, true)
+}
+
+// isHandled reports whether the response for the error was already written.
+func isHandled(err error) bool {
+	handled, _ := errdata.Value(err, errHandled).(bool)
+	return handled
+}
+
 // GetAction returns the most recent action annotation on the error.
 // If none is found, defValue is returned instead.
 func GetAction(err error, defValue string) string {
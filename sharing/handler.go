@@ -17,7 +17,9 @@ import (
 	"github.com/spacemonkeygo/monkit/v3"
 	"github.com/zeebo/errs"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
+	"storj.io/common/memory"
 	"storj.io/common/rpc/rpcpool"
 	"storj.io/linksharing/objectmap"
 	"storj.io/uplink"
@@ -26,6 +28,9 @@ import (
 
 var mon = monkit.Package()
 
+// defaultIndexFiles is used when no index files are configured.
+var defaultIndexFiles = []string{"index.html"}
+
 // pageData is the type that is passed to the template rendering engine.
 type pageData struct {
 	Data  interface{} // data to provide to the page
@@ -55,19 +60,111 @@ type Config struct {
 	// TxtRecordTTL is the duration for which an entry in the txtRecordCache is valid.
 	TxtRecordTTL time.Duration
 
+	// TxtRecordNegativeTTL is the duration for which hostnames that aren't
+	// set up for hosting are cached. Zero disables negative caching.
+	TxtRecordNegativeTTL time.Duration
+
+	// TxtRecordStaleIfError is the duration after its expiration for which
+	// an entry in the txtRecordCache keeps being served while refreshing it
+	// fails. Zero disables serving stale entries.
+	TxtRecordStaleIfError time.Duration
+
+	// TxtRecordCacheEntries and TxtRecordCacheSize bound the number of
+	// entries in the txtRecordCache and their approximate size. The least
+	// recently used entries are evicted first. Zero is unbounded.
+	TxtRecordCacheEntries int
+	TxtRecordCacheSize    memory.Size
+
+	// TxtRecordRefreshWorkers is the number of workers refreshing entries of
+	// the txtRecordCache in the background while the handler runs.
+	TxtRecordRefreshWorkers int
+
+	// AccessRevalidationInterval is how often the access keys of cached
+	// txt records, including the ones of their mounts, are resolved again
+	// with the auth service, spread over the interval, so that revoked
+	// access keys stop serving their site. It should be shorter than
+	// TxtRecordTTL. Zero disables revalidation.
+	AccessRevalidationInterval time.Duration
+
+	// TxtRecordWarmupHosts are hostnames whose txt records are resolved at
+	// startup, together with the hostnames listed one per line in
+	// TxtRecordWarmupHostsFile, so that their first visitors don't wait.
+	TxtRecordWarmupHosts     []string
+	TxtRecordWarmupHostsFile string
+
+	// TxtRecordSnapshotFile is where the hostnames in the txtRecordCache
+	// are saved every TxtRecordSnapshotInterval, if it's positive, and on
+	// shutdown, for warming up the cache with them at startup.
+	TxtRecordSnapshotFile     string
+	TxtRecordSnapshotInterval time.Duration
+
+	// RootPointerTTL is how long the root named by the storj-root-pointer
+	// object of a hosted site is cached, independent of the TTL of its txt
+	// records.
+	RootPointerTTL time.Duration
+
 	// AuthServiceConfig contains configuration required to use the auth service to resolve
 	// access key ids into access grants.
 	AuthServiceConfig AuthServiceConfig
 
-	// DNS Server address, for TXT record lookup
+	// HostsFile is the path to a YAML or JSON file mapping hostnames to the
+	// root and access of their sites, which takes precedence over the txt
+	// records. It's reloaded when it changes, and its sites are cached and
+	// revalidated like the ones of txt records.
+	HostsFile string
+
+	// HostInfo enables the /.well-known/storj-linksharing endpoint on hosted
+	// domains, which shows how their txt records were understood and cached
+	// with the access redacted. It requires HostInfoToken, since it tells
+	// which buckets and prefixes serve a site.
+	HostInfo bool
+
+	// HostInfoToken restricts the host info endpoint to requests with an
+	// "Authorization: Bearer <token>" header.
+	HostInfoToken string
+
+	// VerifyHostTargets makes hosted domains only be served when they point
+	// to the link sharing service, that is, they are a CNAME for the host of
+	// one of the URL bases or resolve to its addresses or to one of
+	// HostTargetAddresses. Otherwise anyone could have domains that are
+	// set up for another provider served by sending their Host header.
+	VerifyHostTargets bool
+
+	// HostTargetAddresses are the IP addresses or networks, in CIDR
+	// notation, that hosted domains may resolve to besides the addresses of
+	// the URL bases, e.g. the addresses of a load balancer.
+	HostTargetAddresses []string
+
+	// DNSServers are the addresses of the DNS servers for TXT record
+	// lookup. See NewDNSClient for the supported formats.
+	DNSServers []string
+
+	// DNSServer is the address of the DNS server for TXT record lookup. It's
+	// used when DNSServers is empty and may be a comma separated list.
+	//
+	// Deprecated: use DNSServers.
 	DNSServer string
 
+	// DNSSECPolicy is the default policy for validating the DNSSEC
+	// signatures of TXT records of hosted domains. Only DNSSECRequire
+	// protects against spoofed records, see DNSSECPrefer.
+	DNSSECPolicy DNSSECPolicy
+
+	// DNSSECHostPolicies overrides DNSSECPolicy for the given hosts and
+	// their subdomains.
+	DNSSECHostPolicies map[string]DNSSECPolicy
+
 	// RedirectHTTPS enables redirection to https://.
 	RedirectHTTPS bool
 
 	// LandingRedirectTarget is the url to redirect empty requests to.
 	LandingRedirectTarget string
 
+	// IndexFiles is the list of object names that are looked up, in order,
+	// when a prefix is requested. Defaults to index.html. Hosted sites may
+	// override it with the storj-index TXT field.
+	IndexFiles []string
+
 	// uplink Config settings
 	Uplink *uplink.Config
 
@@ -109,17 +206,31 @@ type Handler struct {
 	templates            *template.Template
 	mapper               *objectmap.IPDB
 	txtRecords           *txtRecords
+	txtWarmer            *txtWarmer
+	staticHosts          *staticHosts
 	authConfig           AuthServiceConfig
 	static               http.Handler
 	redirectHTTPS        bool
 	landingRedirect      string
+	indexFiles           []string
 	uplink               *uplink.Config
 	trustedClientIPsList trustedIPsList
+	hostInfo             bool
+	hostInfoToken        string
+}
+
+// dnsServers returns DNSServers, or the servers of the deprecated DNSServer
+// if it's empty.
+func (config *Config) dnsServers() []string {
+	if len(config.DNSServers) > 0 {
+		return config.DNSServers
+	}
+	return SplitList(config.DNSServer)
 }
 
 // NewHandler creates a new link sharing HTTP handler.
 func NewHandler(log *zap.Logger, mapper *objectmap.IPDB, config Config) (*Handler, error) {
-	dns, err := NewDNSClient(config.DNSServer)
+	dns, err := NewDNSClient(config.dnsServers()...)
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +267,85 @@ func NewHandler(log *zap.Logger, mapper *objectmap.IPDB, config Config) (*Handle
 		return nil, err
 	}
 
+	var indexFiles []string
+	for _, name := range config.IndexFiles {
+		if name = strings.TrimSpace(name); name != "" {
+			indexFiles = append(indexFiles, name)
+		}
+	}
+	if len(indexFiles) == 0 {
+		indexFiles = defaultIndexFiles
+	}
+
+	if config.HostInfo && config.HostInfoToken == "" {
+		return nil, errs.New("host info requires a host info token")
+	}
+
+	if _, err := ParseDNSSECPolicy(string(config.DNSSECPolicy)); err != nil {
+		return nil, err
+	}
+	for _, policy := range config.DNSSECHostPolicies {
+		if _, err := ParseDNSSECPolicy(string(policy)); err != nil {
+			return nil, err
+		}
+	}
+
+	var targets *hostTargets
+	if config.VerifyHostTargets {
+		targets, err = newHostTargets(bases, config.HostTargetAddresses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var staticHosts *staticHosts
+	if config.HostsFile != "" {
+		staticHosts, err = newStaticHosts(log, config.HostsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	txtRecords := newTxtRecords(txtRecordsConfig{
+		maxTTL:       config.TxtRecordTTL,
+		negativeTTL:  config.TxtRecordNegativeTTL,
+		staleIfError: config.TxtRecordStaleIfError,
+		maxEntries:   config.TxtRecordCacheEntries,
+		maxBytes:     config.TxtRecordCacheSize.Int64(),
+
+		refreshWorkers:     config.TxtRecordRefreshWorkers,
+		revalidateInterval: config.AccessRevalidationInterval,
+		rootPointerTTL:     config.RootPointerTTL,
+		targets:            targets,
+		static:             staticHosts,
+		dnssec: dnssecPolicies{
+			defaultPolicy: config.DNSSECPolicy,
+			hosts:         config.DNSSECHostPolicies,
+		},
+	}, dns, config.AuthServiceConfig)
+	if staticHosts != nil {
+		staticHosts.changed = func(hostnames []string) {
+			for _, hostname := range hostnames {
+				txtRecords.cache.Delete(hostname)
+			}
+		}
+	}
+
+	var warmupHosts []string
+	for _, host := range config.TxtRecordWarmupHosts {
+		if host = strings.TrimSpace(host); host != "" {
+			warmupHosts = append(warmupHosts, host)
+		}
+	}
+	var warmer *txtWarmer
+	if len(warmupHosts) > 0 || config.TxtRecordWarmupHostsFile != "" || config.TxtRecordSnapshotFile != "" {
+		warmer, err = newTxtWarmer(log, txtRecords, warmupHosts, config.TxtRecordWarmupHostsFile,
+			config.TxtRecordSnapshotFile, config.TxtRecordSnapshotInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var trustedClientIPs trustedIPsList
 	if config.UseClientIPHeaders {
 		if len(config.ClientTrustedIPsList) > 0 {
@@ -172,26 +362,58 @@ func NewHandler(log *zap.Logger, mapper *objectmap.IPDB, config Config) (*Handle
 		urlBases:             bases,
 		templates:            templates,
 		mapper:               mapper,
-		txtRecords:           newTxtRecords(config.TxtRecordTTL, dns, config.AuthServiceConfig),
+		txtRecords:           txtRecords,
+		txtWarmer:            warmer,
+		staticHosts:          staticHosts,
 		authConfig:           config.AuthServiceConfig,
 		static:               http.StripPrefix("/static/", http.FileServer(http.Dir(config.StaticSourcesPath))),
 		landingRedirect:      config.LandingRedirectTarget,
 		redirectHTTPS:        config.RedirectHTTPS,
+		indexFiles:           indexFiles,
 		uplink:               uplinkConfig,
 		trustedClientIPsList: trustedClientIPs,
+		hostInfo:             config.HostInfo,
+		hostInfoToken:        config.HostInfoToken,
 	}, nil
 }
 
+// Run runs the background services of the handler, such as refreshing the
+// txt records of hosted sites, warming up their cache and reloading the hosts
+// file, until ctx is canceled.
+func (handler *Handler) Run(ctx context.Context) error {
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return handler.txtRecords.Run(ctx)
+	})
+	if handler.staticHosts != nil {
+		group.Go(func() error {
+			return handler.staticHosts.Run(ctx)
+		})
+	}
+	if handler.txtWarmer != nil {
+		group.Go(func() error {
+			return handler.txtWarmer.Run(ctx)
+		})
+	}
+	return group.Wait()
+}
+
 // ServeHTTP handles link sharing requests.
 func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	defer mon.Task()(&ctx)(nil)
 
 	handlerErr := handler.serveHTTP(ctx, w, r)
-	if handlerErr == nil {
+	if handlerErr == nil || isHandled(handlerErr) {
 		return
 	}
+	handler.handleError(ctx, w, handlerErr)
+}
 
+// handleError logs handlerErr and writes the error response for it. The
+// custom error pages of a hosted site are used if the error is annotated with
+// them.
+func (handler *Handler) handleError(ctx context.Context, w http.ResponseWriter, handlerErr error) {
 	status := http.StatusInternalServerError
 	message := "Internal server error. Please try again later."
 	action := GetAction(handlerErr, "unknown")
@@ -232,6 +454,9 @@ func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	default:
 		status = GetStatus(handlerErr, status)
 		switch status {
+		case http.StatusUnauthorized:
+			message = "Authentication required."
+			skipLog = true
 		case http.StatusForbidden:
 			message = "Access denied."
 			skipLog = true
@@ -259,10 +484,33 @@ func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
+	if pages := getErrorPages(handlerErr); pages != nil {
+		if handler.serveErrorPage(ctx, w, pages, status) {
+			return
+		}
+	}
+
 	w.WriteHeader(status)
 	handler.renderTemplate(w, "error.html", pageData{Data: message, Title: "Error"})
 }
 
+// HostPolicy returns an error unless TLS certificates may be issued for host,
+// which is the case for the hosts of the URL bases and for hosts that are set
+// up for website hosting with TXT records, see txtRecordNames. The results for
+// other hosts are cached like their records, see txtRecords.checkHost.
+func (handler *Handler) HostPolicy(ctx context.Context, host string) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	ours, err := isDomainOurs(host, handler.urlBases)
+	if err != nil {
+		return err
+	}
+	if ours || handler.staticHosts.contains(host) {
+		return nil
+	}
+	return handler.txtRecords.checkHost(ctx, host)
+}
+
 func (handler *Handler) renderTemplate(w http.ResponseWriter, template string, data pageData) {
 	data.Base = strings.TrimSuffix(handler.urlBases[0].String(), "/")
 	err := handler.templates.ExecuteTemplate(w, template, data)
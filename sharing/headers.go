@@ -0,0 +1,103 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// headersFile is the name of the object in the hosted root that contains
+// custom response headers.
+const headersFile = "_headers"
+
+// protectedHeaders are headers that a _headers file is not allowed to set,
+// because they are managed by the server when serving content.
+var protectedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Transfer-Encoding": true,
+}
+
+// headerRule is a path pattern with the headers to set for matching paths.
+type headerRule struct {
+	pattern string
+	header  http.Header
+}
+
+// parseHeaders parses a Netlify-style _headers file. A line starting with a
+// slash begins a new rule for the path pattern on it, in which an asterisk
+// matches any sequence of characters. The following lines of the form
+// "Name: value" list the headers to set for matching paths. Comments, blank
+// lines and headers outside of a rule are ignored.
+func parseHeaders(data []byte) (rules []headerRule) {
+	var current *headerRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			rules = append(rules, headerRule{pattern: line, header: http.Header{}})
+			current = &rules[len(rules)-1]
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 2)
+		if current == nil || len(fields) != 2 {
+			continue
+		}
+		name := http.CanonicalHeaderKey(strings.TrimSpace(fields[0]))
+		if name == "" || protectedHeaders[name] {
+			continue
+		}
+		current.header.Add(name, strings.TrimSpace(fields[1]))
+	}
+	return rules
+}
+
+// matchHeaders returns the combined headers of all rules matching urlPath.
+func matchHeaders(rules []headerRule, urlPath string) http.Header {
+	header := http.Header{}
+	for _, rule := range rules {
+		if !matchGlob(rule.pattern, urlPath) {
+			continue
+		}
+		for name, values := range rule.header {
+			header[name] = append(header[name], values...)
+		}
+	}
+	return header
+}
+
+// matchGlob reports whether s matches pattern, where an asterisk matches any
+// sequence of characters, including slashes.
+func matchGlob(pattern, s string) bool {
+	star, starMatch := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, starMatch = p, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			starMatch++
+			p, i = star+1, starMatch
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
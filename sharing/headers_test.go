@@ -0,0 +1,72 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndMatchHeaders(t *testing.T) {
+	rules := parseHeaders([]byte(`
+X-Ignored: outside of any rule
+
+# every page
+/*
+  X-Frame-Options: DENY
+  Content-Security-Policy: default-src 'self'
+
+/assets/*
+  Cache-Control: public, max-age=31536000, immutable
+  Content-Length: 0
+
+/*.html
+  Link: </style.css>; rel=preload; as=style
+  Link: </app.js>; rel=preload; as=script
+`))
+	require.Len(t, rules, 3)
+
+	header := matchHeaders(rules, "/assets/img/logo.png")
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+	assert.Equal(t, "default-src 'self'", header.Get("Content-Security-Policy"))
+	assert.Equal(t, "public, max-age=31536000, immutable", header.Get("Cache-Control"))
+	assert.Empty(t, header.Get("Content-Length"))
+	assert.Empty(t, header.Get("Link"))
+	assert.Empty(t, header.Get("X-Ignored"))
+
+	header = matchHeaders(rules, "/docs/index.html")
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+	assert.Empty(t, header.Get("Cache-Control"))
+	assert.Equal(t, []string{
+		"</style.css>; rel=preload; as=style",
+		"</app.js>; rel=preload; as=script",
+	}, header["Link"])
+
+	assert.Equal(t, http.Header{}, matchHeaders(nil, "/"))
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"/", "/", true},
+		{"/", "/a", false},
+		{"/*", "/", true},
+		{"/*", "/a/b/c", true},
+		{"/a/*", "/a/", true},
+		{"/a/*", "/a", false},
+		{"/*.html", "/a/b.html", true},
+		{"/*.html", "/a/b.htm", false},
+		{"/a/*/c", "/a/b/x/c", true},
+		{"/a/*/c", "/a/b/x/d", false},
+		{"/about", "/about", true},
+		{"/about", "/about/", false},
+	} {
+		assert.Equal(t, test.match, matchGlob(test.pattern, test.s), "%q %q", test.pattern, test.s)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"storj.io/uplink"
+)
+
+// HostCheckStatus is the outcome of a check of the setup of a hosted domain.
+type HostCheckStatus int
+
+const (
+	// HostCheckOK means the check passed.
+	HostCheckOK HostCheckStatus = iota
+	// HostCheckWarning means the site is served, but possibly not as
+	// intended.
+	HostCheckWarning
+	// HostCheckFailed means the site can't be served.
+	HostCheckFailed
+)
+
+// String returns a short name of the status.
+func (status HostCheckStatus) String() string {
+	switch status {
+	case HostCheckOK:
+		return "ok"
+	case HostCheckWarning:
+		return "warning"
+	default:
+		return "failed"
+	}
+}
+
+// HostCheck is the result of a single check of the setup of a hosted domain.
+type HostCheck struct {
+	Name   string
+	Status HostCheckStatus
+	Detail string
+	// Fix describes how to fix the setup when the check didn't pass.
+	Fix string
+}
+
+// HostReport is the result of checking the setup of a hosted domain.
+type HostReport struct {
+	Hostname string
+	Checks   []HostCheck
+}
+
+// Failed reports whether any of the checks failed.
+func (report *HostReport) Failed() bool {
+	for _, check := range report.Checks {
+		if check.Status == HostCheckFailed {
+			return true
+		}
+	}
+	return false
+}
+
+func (report *HostReport) add(name string, status HostCheckStatus, detail, fix string) {
+	report.Checks = append(report.Checks, HostCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// CheckHost checks whether hostname is set up for website hosting with the
+// link sharing service configured by config, doing the same lookups as the
+// service would: it checks that hostname points to one of the URL bases, that
+// its entry in the hosts file or its TXT records have a valid access and
+// root, and that the root and the roots of its mounts have content. It only
+// returns an error if config is invalid.
+func CheckHost(ctx context.Context, config Config, hostname string) (_ *HostReport, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	dns, err := NewDNSClient(config.dnsServers()...)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &hostChecker{
+		dns:        dns,
+		auth:       config.AuthServiceConfig,
+		uplink:     config.Uplink,
+		indexFiles: config.IndexFiles,
+		records: newTxtRecords(txtRecordsConfig{
+			dnssec: dnssecPolicies{
+				defaultPolicy: config.DNSSECPolicy,
+				hosts:         config.DNSSECHostPolicies,
+			},
+		}, dns, config.AuthServiceConfig),
+	}
+	if checker.uplink == nil {
+		checker.uplink = &uplink.Config{}
+	}
+	if config.HostsFile != "" {
+		checker.static, err = newStaticHosts(zap.NewNop(), config.HostsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var bases []*url.URL
+	for _, base := range config.URLBases {
+		parsed, err := parseURLBase(base)
+		if err != nil {
+			return nil, err
+		}
+		bases = append(bases, parsed)
+	}
+	checker.targets, err = newHostTargets(bases, config.HostTargetAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return checker.check(ctx, hostname), nil
+}
+
+// hostChecker checks the setup of hosted domains, see CheckHost.
+type hostChecker struct {
+	records    *txtRecords
+	static     *staticHosts
+	dns        *DNSClient
+	targets    *hostTargets
+	auth       AuthServiceConfig
+	uplink     *uplink.Config
+	indexFiles []string
+}
+
+func (checker *hostChecker) check(ctx context.Context, hostname string) *HostReport {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	report := &HostReport{Hostname: hostname}
+
+	checker.checkTarget(ctx, report)
+
+	if config, ok := checker.static.lookup(hostname); ok {
+		report.add("hosts file", HostCheckOK, fmt.Sprintf("%s is in the hosts file, which takes precedence over TXT records", hostname), "")
+		access := checker.checkAccess(ctx, report, config.Access, true)
+		if access == nil {
+			return report
+		}
+		checker.checkRoot(ctx, report, &txtRecord{access: access, site: &siteRoot{root: config.Root}}, "the hosts file", nil)
+		return report
+	}
+
+	set, name, subdomain, err := checker.records.lookupHostingSet(ctx, hostname)
+	if err != nil {
+		report.add("txt record", HostCheckFailed, fmt.Sprintf("looking up the TXT records of %s failed: %v", hostname, err),
+			fmt.Sprintf("make sure the TXT records of %s resolve, e.g. with `dig txt-%s TXT`, `dig _storj.%s TXT` and `dig _storj-%s TXT`", hostname, hostname, hostname, hostname))
+		return report
+	}
+	if !isHostingSet(set) {
+		var missing []string
+		if serializedAccess, _ := lookupHostingFields(set); serializedAccess == "" {
+			missing = append(missing, "storj-access")
+		}
+		if _, root := lookupHostingFields(set); root == "" && set.Lookup("storj-root-pointer") == "" {
+			missing = append(missing, "storj-root")
+		}
+		report.add("txt record", HostCheckFailed, fmt.Sprintf("%s has no %s field", name, strings.Join(missing, " and no ")),
+			fmt.Sprintf("create TXT records txt-%s, or _storj.%s for apex domains, with storj-root:<bucket/prefix> and storj-access:<access>, e.g. as printed by `uplink share --dns %s sj://<bucket/prefix>`", hostname, hostname, hostname))
+		return report
+	}
+	if subdomain != "" {
+		report.add("txt record", HostCheckOK, fmt.Sprintf("using the wildcard record %s for subdomain %q", name, subdomain), "")
+	} else {
+		report.add("txt record", HostCheckOK, fmt.Sprintf("%s sets up hosting", name), "")
+	}
+
+	redirect, err := parseHostRedirect(set)
+	if err != nil {
+		report.add("redirect", HostCheckFailed, err.Error(),
+			"set storj-redirect to an absolute http:// or https:// URL and storj-redirect-status to 301, 302, 307 or 308")
+		return report
+	}
+	if redirect != nil {
+		report.add("redirect", HostCheckOK, fmt.Sprintf("redirects to %s with status %d", redirect.target, redirect.status), "")
+		return report
+	}
+
+	serializedAccess, _ := lookupHostingFields(set)
+	access := checker.checkAccess(ctx, report, serializedAccess, false)
+	if access == nil {
+		return report
+	}
+	if record := checker.rootRecord(report, set, subdomain, access); record != nil {
+		checker.checkRoot(ctx, report, record, "storj-root", SplitList(set.Lookup("storj-index")))
+	}
+	checker.checkMounts(ctx, report, set, access)
+	return report
+}
+
+// checkTarget checks that the hostname points to one of the URL bases, either
+// with a CNAME or by resolving to the same or allowlisted addresses.
+func (checker *hostChecker) checkTarget(ctx context.Context, report *HostReport) {
+	if len(checker.targets.hosts) == 0 {
+		report.add("cname", HostCheckWarning, "no url bases are configured to compare with", "")
+		return
+	}
+
+	fix := fmt.Sprintf("create a CNAME record for %s with target %s", report.Hostname, strings.Join(checker.targets.hosts, " or "))
+	ok, detail, err := checker.targets.match(ctx, checker.dns, report.Hostname)
+	switch {
+	case err != nil:
+		report.add("cname", HostCheckFailed, fmt.Sprintf("resolving %s failed: %v", report.Hostname, err), fix)
+	case !ok:
+		report.add("cname", HostCheckFailed, detail, fix)
+	default:
+		report.add("cname", HostCheckOK, detail, "")
+	}
+}
+
+// checkAccess checks that the access of the TXT record set, or of the hosts
+// file if static, can be parsed or resolved with the auth service. It returns
+// nil if it can't.
+func (checker *hostChecker) checkAccess(ctx context.Context, report *HostReport, serializedAccess string, static bool) *uplink.Access {
+	field, where := "storj-access", "the storj-access records"
+	if static {
+		field, where = "the access of the hosts file", "the hosts file"
+	}
+
+	access, err := parseAccess(ctx, serializedAccess, checker.auth, "")
+	if err != nil {
+		fix := "create a new access grant, e.g. with `uplink share --dns " + report.Hostname + "`, and make sure all of it is in " + where
+		if !isAccessGrant(serializedAccess) {
+			fix = "make sure the access key was registered with the auth service as public and hasn't been revoked"
+		}
+		report.add("access", HostCheckFailed, err.Error(), fix)
+		return nil
+	}
+
+	if isAccessGrant(serializedAccess) {
+		report.add("access", HostCheckOK, field+" is a valid access grant", "")
+	} else {
+		report.add("access", HostCheckOK, field+" is an access key resolved by the auth service", "")
+	}
+	return access
+}
+
+// rootRecord returns the record serving the root of the TXT record set, with
+// either the root or the root pointer of the site. It returns nil if the set
+// has no valid one.
+func (checker *hostChecker) rootRecord(report *HostReport, set *TXTRecordSet, subdomain string, access *uplink.Access) *txtRecord {
+	record := &txtRecord{access: access}
+	var err error
+	record.pointer, err = parseRootPointer(set, subdomain, 0)
+	if err != nil {
+		report.add("root", HostCheckFailed, err.Error(), "set storj-root-pointer to the bucket/key of an object naming the active deploy")
+		return nil
+	}
+	if record.pointer == nil {
+		_, root := lookupHostingFields(set)
+		if subdomain != "" {
+			root, err = expandRoot(root, subdomain)
+			if err != nil {
+				report.add("root", HostCheckFailed, err.Error(), "use {subdomain} only after the bucket of storj-root")
+				return nil
+			}
+		}
+		record.site = &siteRoot{root: root}
+	}
+	return record
+}
+
+// checkRoot checks that the root of the site of record has content and an
+// index document. field names where the root is set up, and indexFiles are
+// the index documents of the site, if it sets any.
+func (checker *hostChecker) checkRoot(ctx context.Context, report *HostReport, record *txtRecord, field string, indexFiles []string) {
+	project, err := checker.uplink.OpenProject(ctx, record.access)
+	if err != nil {
+		report.add("root", HostCheckFailed, fmt.Sprintf("opening the project failed: %v", err), "make sure the satellite of the access is reachable")
+		return
+	}
+	defer func() { _ = project.Close() }()
+
+	site, err := resolveSite(ctx, project, record)
+	if err != nil {
+		report.add("root", HostCheckFailed, fmt.Sprintf("reading the root pointer failed: %v", err),
+			fmt.Sprintf("upload an object sj://%s/%s containing the prefix of the active deploy", record.pointer.bucket, record.pointer.key))
+		return
+	}
+
+	bucket, prefix := determineBucketAndObjectKey(site.root, "")
+	if !checker.checkListing(ctx, report, "root", field, project, site.root) {
+		return
+	}
+	report.add("root", HostCheckOK, fmt.Sprintf("serving sj://%s/%s", bucket, prefix), "")
+
+	if len(indexFiles) == 0 {
+		indexFiles = checker.indexFiles
+	}
+	if len(indexFiles) == 0 {
+		indexFiles = defaultIndexFiles
+	}
+	object, err := statIndex(ctx, project, bucket, prefix, indexFiles)
+	switch {
+	case err == nil:
+		report.add("index", HostCheckOK, fmt.Sprintf("serving sj://%s/%s for /", bucket, object.Key), "")
+	case errors.Is(err, uplink.ErrObjectNotFound):
+		report.add("index", HostCheckWarning, fmt.Sprintf("there is no %s in sj://%s/%s, so / shows a listing or an error", strings.Join(indexFiles, " or "), bucket, prefix),
+			fmt.Sprintf("upload your home page as sj://%s/%s%s", bucket, prefix, indexFiles[0]))
+	default:
+		report.add("index", HostCheckFailed, fmt.Sprintf("looking up %s failed: %v", strings.Join(indexFiles, " or "), err),
+			"share the root with read permission")
+	}
+}
+
+// checkMounts checks that the mounts of the TXT record set are valid and that
+// their roots have content.
+func (checker *hostChecker) checkMounts(ctx context.Context, report *HostReport, set *TXTRecordSet, access *uplink.Access) {
+	mounts, err := parseMounts(ctx, set, checker.auth, "")
+	if err != nil {
+		report.add("mounts", HostCheckFailed, err.Error(),
+			"fix the storj-mount-<path> and storj-mount-access-<path> records, whose paths can't contain _ or end in -<number>")
+		return
+	}
+
+	for _, mount := range mounts {
+		name := "mount " + mount.prefix
+		using := "the access of the site"
+		mountAccess := access
+		if mount.access != nil {
+			using, mountAccess = "storj-mount-access-"+mount.prefix, mount.access
+		}
+
+		project, err := checker.uplink.OpenProject(ctx, mountAccess)
+		if err != nil {
+			report.add(name, HostCheckFailed, fmt.Sprintf("opening the project failed: %v", err), "make sure the satellite of the access is reachable")
+			continue
+		}
+		if checker.checkListing(ctx, report, name, "storj-mount-"+mount.prefix, project, mount.root) {
+			bucket, prefix := determineBucketAndObjectKey(mount.root, "")
+			report.add(name, HostCheckOK, fmt.Sprintf("serving sj://%s/%s for %s/ with %s", bucket, prefix, mount.prefix, using), "")
+		}
+		_ = project.Close()
+	}
+}
+
+// checkListing checks that root has content, adding a failed check named name
+// if it doesn't. field names where root is set up.
+func (checker *hostChecker) checkListing(ctx context.Context, report *HostReport, name, field string, project *uplink.Project, root string) bool {
+	bucket, prefix := determineBucketAndObjectKey(root, "")
+	objects := project.ListObjects(ctx, bucket, &uplink.ListObjectsOptions{Prefix: prefix})
+	hasContent := objects.Next()
+	switch err := objects.Err(); {
+	case errors.Is(err, uplink.ErrBucketNotFound):
+		report.add(name, HostCheckFailed, fmt.Sprintf("bucket %q doesn't exist", bucket), "fix the bucket in "+field+" or create it and upload your site")
+	case errors.Is(err, uplink.ErrPermissionDenied):
+		report.add(name, HostCheckFailed, fmt.Sprintf("the access can't list sj://%s/%s", bucket, prefix),
+			"share the root with read and list permissions, e.g. with `uplink share --dns "+report.Hostname+" sj://"+root+"`")
+	case err != nil:
+		report.add(name, HostCheckFailed, fmt.Sprintf("listing sj://%s/%s failed: %v", bucket, prefix, err), "make sure the satellite of the access is reachable")
+	case !hasContent:
+		report.add(name, HostCheckFailed, fmt.Sprintf("sj://%s/%s is empty", bucket, prefix), "upload your site to sj://"+root)
+	default:
+		return true
+	}
+	return false
+}
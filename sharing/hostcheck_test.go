@@ -0,0 +1,119 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+	"storj.io/uplink"
+)
+
+func TestHostChecker(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	// encoded like an access grant, so it's rejected without asking the
+	// auth service.
+	invalidAccess := base58.CheckEncode([]byte("invalid"), 0)
+	// a valid access grant of a satellite that isn't running.
+	serializedAccess := newTestAccess(t)
+
+	header := func(m *dns.Msg, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: m.Question[0].Name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 60}
+	}
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		q := m.Question[0]
+		switch {
+		case q.Name == "www.example.test." && q.Qtype == dns.TypeCNAME:
+			r.Answer = append(r.Answer, &dns.CNAME{Hdr: header(m, dns.TypeCNAME), Target: "link.example.test."})
+		case q.Name == "txt-www.example.test.":
+			r.Answer = append(r.Answer, &dns.TXT{Hdr: header(m, dns.TypeTXT), Txt: []string{"storj-redirect:https://example.test"}})
+		case (q.Name == "apex.test." || q.Name == "link.example.test.") && q.Qtype == dns.TypeA:
+			r.Answer = append(r.Answer, &dns.A{Hdr: header(m, dns.TypeA), A: net.IPv4(192, 0, 2, 1)})
+		case q.Name == "txt-apex.test.":
+			r.Answer = append(r.Answer, &dns.TXT{Hdr: header(m, dns.TypeTXT), Txt: []string{"storj-root:bucket", "storj-access:" + invalidAccess}})
+		case q.Name == "mounts.test." && q.Qtype == dns.TypeCNAME:
+			r.Answer = append(r.Answer, &dns.CNAME{Hdr: header(m, dns.TypeCNAME), Target: "link.example.test."})
+		case q.Name == "txt-mounts.test.":
+			r.Answer = append(r.Answer, &dns.TXT{Hdr: header(m, dns.TypeTXT), Txt: []string{"storj-root:bucket", "storj-access:" + serializedAccess, "storj-mount-/v-1:bucket2"}})
+		case q.Name == "other.test." && q.Qtype == dns.TypeCNAME:
+			r.Answer = append(r.Answer, &dns.CNAME{Hdr: header(m, dns.TypeCNAME), Target: "elsewhere.test."})
+		case q.Name == "txt-other.test.":
+			r.Answer = append(r.Answer, &dns.TXT{Hdr: header(m, dns.TypeTXT), Txt: []string{"storj-root:bucket"}})
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+
+	cli := &DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}
+	checker := &hostChecker{
+		records: newTxtRecords(txtRecordsConfig{}, cli, AuthServiceConfig{}),
+		dns:     cli,
+		targets: &hostTargets{hosts: []string{"link.example.test"}},
+		uplink:  &uplink.Config{},
+		static: &staticHosts{hosts: map[string]staticHostConfig{
+			"static.test": {Root: "bucket", Access: invalidAccess},
+		}},
+	}
+
+	statuses := func(report *HostReport) map[string]HostCheckStatus {
+		statuses := make(map[string]HostCheckStatus)
+		for _, check := range report.Checks {
+			statuses[check.Name] = check.Status
+			if check.Status != HostCheckOK {
+				require.NotEmpty(t, check.Fix, check.Name)
+			}
+		}
+		return statuses
+	}
+
+	report := checker.check(ctx, "WWW.example.test.")
+	require.Equal(t, "www.example.test", report.Hostname)
+	require.False(t, report.Failed())
+	require.Equal(t, map[string]HostCheckStatus{
+		"cname":      HostCheckOK,
+		"txt record": HostCheckOK,
+		"redirect":   HostCheckOK,
+	}, statuses(report))
+
+	// an apex domain resolving to the same addresses is fine, but its access
+	// isn't.
+	report = checker.check(ctx, "apex.test")
+	require.True(t, report.Failed())
+	require.Equal(t, map[string]HostCheckStatus{
+		"cname":      HostCheckOK,
+		"txt record": HostCheckOK,
+		"access":     HostCheckFailed,
+	}, statuses(report))
+
+	// the hosts file takes precedence over the TXT records, which static.test
+	// doesn't have.
+	report = checker.check(ctx, "static.test")
+	require.True(t, report.Failed())
+	require.Equal(t, map[string]HostCheckStatus{
+		"cname":      HostCheckFailed,
+		"hosts file": HostCheckOK,
+		"access":     HostCheckFailed,
+	}, statuses(report))
+
+	report = checker.check(ctx, "mounts.test")
+	require.True(t, report.Failed())
+	require.Equal(t, HostCheckOK, statuses(report)["access"])
+	require.Equal(t, HostCheckFailed, statuses(report)["mounts"])
+
+	report = checker.check(ctx, "other.test")
+	require.True(t, report.Failed())
+	require.Equal(t, map[string]HostCheckStatus{
+		"cname":      HostCheckFailed,
+		"txt record": HostCheckFailed,
+	}, statuses(report))
+}
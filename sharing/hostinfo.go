@@ -0,0 +1,173 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// hostInfoPath is the path of the host info endpoint on hosted domains.
+const hostInfoPath = "/.well-known/storj-linksharing"
+
+// redactedValue replaces the values of TXT fields holding secrets.
+const redactedValue = "[redacted]"
+
+// hostInfo shows how a hosted domain is set up as seen by the service, for
+// debugging it without access to the service's logs or DNS resolvers.
+type hostInfo struct {
+	Hostname string `json:"hostname"`
+	// Source is where the setup comes from, "dns" or "hosts file".
+	Source string `json:"source"`
+	Error  string `json:"error,omitempty"`
+
+	// Record is the name of the TXT record that was used, which is a
+	// wildcard record if Subdomain is set.
+	Record    string              `json:"record,omitempty"`
+	Subdomain string              `json:"subdomain,omitempty"`
+	Fields    map[string][]string `json:"fields,omitempty"`
+
+	// AccessField and RootField are the names of the fields the access and
+	// root were found in, since older names are still supported.
+	AccessField string `json:"access_field,omitempty"`
+	RootField   string `json:"root_field,omitempty"`
+	// Root is the root the site is served from, which isn't known for a
+	// root pointer until it was first read.
+	Root        string `json:"root,omitempty"`
+	RootPointer string `json:"root_pointer,omitempty"`
+	Redirect    string `json:"redirect,omitempty"`
+
+	Cache *hostCacheInfo `json:"cache,omitempty"`
+}
+
+// hostCacheInfo shows the state of the cached txt record of a hosted domain.
+type hostCacheInfo struct {
+	Expiration  string `json:"expiration"`
+	RefreshAt   string `json:"refresh_at,omitempty"`
+	StaleUntil  string `json:"stale_until,omitempty"`
+	RefreshedAt string `json:"refreshed_at,omitempty"`
+	// RefreshError is why the last refresh failed, or why the hostname is
+	// negatively cached.
+	RefreshError string `json:"refresh_error,omitempty"`
+}
+
+// serveHostInfo serves the host info of host as JSON. It requires the host
+// info token as bearer token.
+func (handler *Handler) serveHostInfo(ctx context.Context, w http.ResponseWriter, r *http.Request, host string) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	authorization := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if handler.hostInfoToken == "" || token == authorization || subtle.ConstantTimeCompare([]byte(token), []byte(handler.hostInfoToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		return WithStatus(errs.New("unauthorized"), http.StatusUnauthorized)
+	}
+
+	info := &hostInfo{Hostname: host, Source: "dns"}
+	if handler.staticHosts.contains(host) {
+		info.Source = "hosts file"
+	}
+
+	clientIP := getClientIP(handler.trustedClientIPsList, r)
+	record, err := handler.txtRecords.fetchAccessForHost(ctx, host, clientIP)
+	if entry, ok := handler.txtRecords.cache.Peek(strings.ToLower(host)); ok {
+		info.Cache = newHostCacheInfo(entry)
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+
+	if record != nil {
+		info.addRecord(record)
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, err = w.Write(data)
+	return err
+}
+
+// addRecord adds the details of the record to the info.
+func (info *hostInfo) addRecord(record *txtRecord) {
+	if record.site != nil {
+		info.Root = record.site.root
+	}
+	if record.pointer != nil {
+		info.RootPointer = record.pointer.bucket + "/" + record.pointer.key
+		if site := record.pointer.cached(); site != nil {
+			info.Root = site.root
+		}
+	}
+	if record.redirect != nil {
+		info.Redirect = record.redirect.target.String()
+	}
+
+	set := record.set
+	if set == nil {
+		return
+	}
+
+	info.Record = record.name
+	info.Subdomain = record.subdomain
+	info.AccessField, info.RootField = hostingFieldNames(set)
+
+	info.Fields = make(map[string][]string)
+	for _, name := range set.Fields("") {
+		key := strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+		values := set.LookupAll(key)
+		if isSecretField(key) {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+		info.Fields[name] = values
+	}
+}
+
+// isSecretField reports whether the values of the TXT field key must not be
+// shown, such as the access.
+func isSecretField(key string) bool {
+	for _, prefix := range []string{"storj-access", "storj-grant", mountAccessField, "storj-auth"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHostCacheInfo returns the info of a cache entry.
+func newHostCacheInfo(entry *txtCacheEntry) *hostCacheInfo {
+	info := &hostCacheInfo{
+		Expiration:  formatHostInfoTime(entry.expiration),
+		RefreshAt:   formatHostInfoTime(entry.refreshAt),
+		StaleUntil:  formatHostInfoTime(entry.staleUntil),
+		RefreshedAt: formatHostInfoTime(entry.refreshedAt),
+	}
+	switch {
+	case entry.refreshErr != nil:
+		info.RefreshError = entry.refreshErr.Error()
+	case entry.err != nil:
+		info.RefreshError = entry.err.Error()
+	}
+	return info
+}
+
+// formatHostInfoTime formats t for the host info, or returns an empty string
+// if t is zero.
+func formatHostInfoTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"storj.io/common/testcontext"
+	"storj.io/linksharing/objectmap"
+)
+
+func TestServeHostInfo(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		if m.Question[0].Name != "txt-*.preview.example.test." {
+			r.Rcode = dns.RcodeNameError
+			return r, nil
+		}
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"storj-path:previews/{subdomain}", "storj_grant:" + serializedAccess, "storj-spa:index.html"},
+		})
+		return r, nil
+	})
+
+	handler := &Handler{
+		txtRecords: newTxtRecords(txtRecordsConfig{maxTTL: time.Hour, negativeTTL: time.Minute},
+			&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{}),
+		trustedClientIPsList: newTrustedIPsListUntrustAll(),
+		hostInfo:             true,
+		hostInfoToken:        "secret",
+	}
+
+	serve := func(host, authorization string) (*httptest.ResponseRecorder, hostInfo) {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+hostInfoPath, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		err := handler.handleHostingService(ctx, w, r)
+		if err != nil {
+			w.Code = GetStatus(err, http.StatusInternalServerError)
+			return w, hostInfo{}
+		}
+
+		var info hostInfo
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		return w, info
+	}
+
+	w, info := serve("pr-42.preview.example.test", "Bearer secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "dns", info.Source)
+	require.Empty(t, info.Error)
+	require.Equal(t, "txt-*.preview.example.test", info.Record)
+	require.Equal(t, "pr-42", info.Subdomain)
+	require.Equal(t, "storj-grant", info.AccessField)
+	require.Equal(t, "storj-path", info.RootField)
+	require.Equal(t, "previews/pr-42", info.Root)
+	require.Equal(t, map[string][]string{
+		"storj-path":  {"previews/{subdomain}"},
+		"storj_grant": {redactedValue},
+		"storj-spa":   {"index.html"},
+	}, info.Fields)
+	require.NotNil(t, info.Cache)
+	require.NotEmpty(t, info.Cache.Expiration)
+	require.NotEmpty(t, info.Cache.RefreshedAt)
+	require.NotContains(t, w.Body.String(), serializedAccess)
+
+	// hostnames that aren't set up show why.
+	w, info = serve("www.example.test", "Bearer secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEmpty(t, info.Error)
+	require.NotNil(t, info.Cache)
+	require.NotEmpty(t, info.Cache.RefreshError)
+
+	// it's admin-only.
+	w, _ = serve("pr-42.preview.example.test", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = serve("pr-42.preview.example.test", "secret")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = serve("pr-42.preview.example.test", "Bearer wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHostInfoRequiresToken(t *testing.T) {
+	config := Config{
+		URLBases:  []string{"http://test.test"},
+		Templates: "../web",
+		HostInfo:  true,
+	}
+	_, err := NewHandler(&zap.Logger{}, &objectmap.IPDB{}, config)
+	require.Error(t, err)
+
+	config.HostInfoToken = "secret"
+	_, err = NewHandler(&zap.Logger{}, &objectmap.IPDB{}, config)
+	require.NoError(t, err)
+}
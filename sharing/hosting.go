@@ -7,15 +7,25 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/zeebo/errs"
 	"go.uber.org/zap"
 
+	"storj.io/common/memory"
 	"storj.io/uplink"
 )
 
+// maxSiteFileSize limits how much of a site configuration object, such as
+// _redirects, is read.
+const maxSiteFileSize = memory.MiB
+
 // handleHostingService deals with linksharing via custom URLs.
 func (handler *Handler) handleHostingService(ctx context.Context, w http.ResponseWriter, r *http.Request) (err error) {
 	defer mon.Task()(&ctx)(&err)
@@ -30,14 +40,27 @@ func (handler *Handler) handleHostingService(ctx context.Context, w http.Respons
 		}
 	}
 
-	access, root, err := handler.txtRecords.fetchAccessForHost(
-		ctx, host, getClientIP(handler.trustedClientIPsList, r),
-	)
+	if handler.hostInfo && r.URL.Path == hostInfoPath {
+		return handler.serveHostInfo(ctx, w, r, host)
+	}
+
+	clientIP := getClientIP(handler.trustedClientIPsList, r)
+	record, err := handler.txtRecords.fetchAccessForHost(ctx, host, clientIP)
 	if err != nil {
 		return WithAction(err, "fetch access")
 	}
+	if record.redirect != nil {
+		http.Redirect(w, r, record.redirect.location(r), record.redirect.status)
+		return nil
+	}
+
+	access := record.access
 
-	bucket, key := determineBucketAndObjectKey(root, r.URL.Path)
+	if record.auth != nil && !record.auth.authorize(r) {
+		realm := strings.ReplaceAll(host, `"`, "")
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+		return WithStatus(errs.New("unauthorized"), http.StatusUnauthorized)
+	}
 
 	project, err := handler.uplink.OpenProject(ctx, access)
 	if err != nil {
@@ -49,22 +72,108 @@ func (handler *Handler) handleHostingService(ctx context.Context, w http.Respons
 		}
 	}()
 
+	site, err := resolveSite(ctx, project, record)
+	if err != nil {
+		return err
+	}
+	root := site.root
+
+	// from here on, errors are rendered with the site's own error pages,
+	// which are served while the projects of the request are still open.
+	// The error is still returned, so that it's recorded for the request.
+	pages := &errorPages{project: project, site: site}
+	defer func() {
+		if err != nil {
+			handler.handleError(ctx, w, withErrorPages(err, pages))
+			err = withHandled(err)
+		}
+	}()
+
+	rules, err := handler.loadRedirects(ctx, project, site)
+	if err != nil {
+		return err
+	}
+	if rule, destination, ok := matchRedirects(rules, r.URL.Path); ok {
+		if rule.status != http.StatusOK {
+			if !strings.Contains(destination, "?") && r.URL.RawQuery != "" {
+				destination += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, destination, rule.status)
+			return nil
+		}
+		// a rewrite serves the destination as if it had been requested.
+		r = r.Clone(ctx)
+		r.URL.Path, r.URL.RawPath = destination, ""
+	}
+
+	headerRules, err := handler.loadHeaders(ctx, project, site)
+	if err != nil {
+		return err
+	}
+
+	// a mount serves its prefix from its own root, and possibly with its own
+	// access and thus project.
+	contentAccess, contentRoot, contentProject, urlPath := access, root, project, r.URL.Path
+	if mount, relativePath := matchMount(record.mounts, urlPath); mount != nil {
+		if relativePath == "/" && !strings.HasSuffix(urlPath, "/") {
+			target := url.URL{Path: urlPath + "/", RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusSeeOther)
+			return nil
+		}
+		contentRoot, urlPath = mount.root, relativePath
+		if mount.access != nil {
+			contentAccess = mount.access
+			contentProject, err = handler.uplink.OpenProject(ctx, contentAccess)
+			if err != nil {
+				return WithAction(err, "open project - mount")
+			}
+			defer func() {
+				if err := contentProject.Close(); err != nil {
+					handler.log.With(zap.Error(err)).Warn("unable to close project")
+				}
+			}()
+		}
+		pages.mountProject, pages.mountRoot = contentProject, contentRoot
+	}
+
+	bucket, key := determineBucketAndObjectKey(contentRoot, urlPath)
+
+	indexFiles := record.indexFiles
+	if len(indexFiles) == 0 {
+		indexFiles = handler.indexFiles
+	}
+
 	visibleKey := strings.TrimPrefix(r.URL.Path, "/")
 	if visibleKey == "" {
 		// special case: if someone is looking for http://sub.domain.tld/,
-		// explicitly assume they shared a prefix and are looking for index.html
-		key += "index.html"
+		// explicitly assume they shared a prefix and are looking for an
+		// index document rather than a listing.
+		o, err := statIndex(ctx, contentProject, bucket, key, indexFiles)
+		switch {
+		case err == nil:
+			key = o.Key
+		case errors.Is(err, uplink.ErrObjectNotFound):
+			key += indexFiles[0]
+		default:
+			return WithAction(err, "stat object - index")
+		}
 	}
 
 	err = handler.presentWithProject(ctx, w, r, &parsedRequest{
-		access:      access,
-		bucket:      bucket,
-		realKey:     key,
-		visibleKey:  visibleKey,
-		title:       host,
-		root:        breadcrumb{Prefix: host, URL: "/"},
-		wrapDefault: false,
-	}, project)
+		access:          contentAccess,
+		bucket:          bucket,
+		realKey:         key,
+		visibleKey:      visibleKey,
+		title:           host,
+		root:            breadcrumb{Prefix: host, URL: "/"},
+		wrapDefault:     record.wrap,
+		downloadDefault: record.download,
+		indexFiles:      indexFiles,
+		cleanURLs:       true,
+		hideListing:     !record.listing,
+		hideMap:         !record.showMap,
+		header:          matchHeaders(headerRules, r.URL.Path),
+	}, contentProject)
 
 	// if the error is anything other than ObjectNotFound, return to normal
 	// error handling. this includes the err == nil case
@@ -72,28 +181,164 @@ func (handler *Handler) handleHostingService(ctx context.Context, w http.Respons
 		return err
 	}
 
-	// in ObjectNotFound, let the user provide a custom 404 page
+	// in ObjectNotFound, a single-page application serves its entry point
+	// and leaves the routing to the client.
+	if record.spa != "" {
+		spaPath := "/" + strings.TrimPrefix(record.spa, "/")
+		bucket, key = determineBucketAndObjectKey(root, spaPath)
+		o, err := project.StatObject(ctx, bucket, key)
+		if err == nil {
+			return handler.showObject(ctx, w, r, &parsedRequest{
+				access:          access,
+				bucket:          bucket,
+				realKey:         key,
+				visibleKey:      visibleKey,
+				title:           host,
+				root:            breadcrumb{Prefix: host, URL: "/"},
+				wrapDefault:     record.wrap,
+				downloadDefault: record.download,
+				hideMap:         !record.showMap,
+				header:          matchHeaders(headerRules, spaPath),
+			}, project, o)
+		}
+		if !errors.Is(err, uplink.ErrObjectNotFound) {
+			return WithAction(err, "stat spa fallback")
+		}
+	}
 
-	bucket, key = determineBucketAndObjectKey(root, "/404.html")
-	download, err := project.DownloadObject(ctx, bucket, key, nil)
+	// otherwise, the site's custom 404.html is served by the central error
+	// handling, if the user provided one.
+	return err
+}
+
+// errorPageStatuses are the status codes for which a hosted site may provide
+// a custom error page named after the status, such as 404.html.
+var errorPageStatuses = map[int]bool{
+	http.StatusForbidden:           true,
+	http.StatusNotFound:            true,
+	http.StatusGone:                true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusServiceUnavailable:  true,
+}
+
+// errorPages are the custom error pages of a hosted site, together with the
+// projects opened for the request to look them up.
+type errorPages struct {
+	project *uplink.Project
+	site    *siteRoot
+
+	// mountProject and mountRoot are set for requests of a mount, whose own
+	// error pages take precedence over the site's.
+	mountProject *uplink.Project
+	mountRoot    string
+}
+
+// serveErrorPage serves the custom error page for status from the root of the
+// mount or of the hosted site, if there is one. It returns false if nothing
+// was written and the default error page should be rendered instead.
+func (handler *Handler) serveErrorPage(ctx context.Context, w http.ResponseWriter, pages *errorPages, status int) (served bool) {
+	var err error
+	defer mon.Task()(&ctx)(&err)
+
+	if !errorPageStatuses[status] {
+		return false
+	}
+
+	pagePath := "/" + strconv.Itoa(status) + ".html"
+	var download *uplink.Download
+	if pages.mountProject != nil {
+		bucket, key := determineBucketAndObjectKey(pages.mountRoot, pagePath)
+		download, err = pages.mountProject.DownloadObject(ctx, bucket, key, nil)
+	}
+	if pages.mountProject == nil || errors.Is(err, uplink.ErrObjectNotFound) {
+		bucket, key := determineBucketAndObjectKey(pages.site.root, pagePath)
+		download, err = pages.project.DownloadObject(ctx, bucket, key, nil)
+	}
 	if err != nil {
-		// if this returns uplink.ErrObjectNotFound, then, that's still
-		// the right error, and we should return it and return our normal
-		// 404 page, so this is fine to just pass through.
-		return WithAction(err, "download 404")
+		if !errors.Is(err, uplink.ErrObjectNotFound) {
+			handler.log.Debug("unable to download error page", zap.Error(err), zap.Int("status_code", status))
+		}
+		return false
 	}
 	defer func() {
 		if err := download.Close(); err != nil {
-			handler.log.With(zap.Error(err)).Warn("unable to close 404 download")
+			handler.log.With(zap.Error(err)).Warn("unable to close error page download")
 		}
 	}()
 
-	w.WriteHeader(http.StatusNotFound)
+	headerRules, err := handler.loadHeaders(ctx, pages.project, pages.site)
+	if err != nil {
+		handler.log.Debug("unable to load headers for error page", zap.Error(err))
+	}
+	for name, values := range matchHeaders(headerRules, pagePath) {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Type", mime.TypeByExtension(".html"))
+
+	w.WriteHeader(status)
 	_, err = io.Copy(w, download)
 	if err != nil {
-		return WithAction(err, "serve 404")
+		handler.log.Debug("unable to serve error page", zap.Error(err), zap.Int("status_code", status))
+	}
+	return true
+}
+
+// loadRedirects returns the redirect rules of the hosted site, downloading and
+// parsing the _redirects object from the root on first use. A missing
+// _redirects object means there are no rules.
+func (handler *Handler) loadRedirects(ctx context.Context, project *uplink.Project, site *siteRoot) (rules []redirectRule, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	value, err := site.redirects.get(func() (interface{}, error) {
+		data, err := downloadSiteFile(ctx, project, site.root, redirectsFile)
+		if err != nil {
+			return nil, WithAction(err, "download redirects")
+		}
+		return parseRedirects(data), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]redirectRule), nil
+}
+
+// loadHeaders returns the custom header rules of the hosted site, downloading
+// and parsing the _headers object from the root on first use. A missing
+// _headers object means there are no rules.
+func (handler *Handler) loadHeaders(ctx context.Context, project *uplink.Project, site *siteRoot) (rules []headerRule, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	value, err := site.headers.get(func() (interface{}, error) {
+		data, err := downloadSiteFile(ctx, project, site.root, headersFile)
+		if err != nil {
+			return nil, WithAction(err, "download headers")
+		}
+		return parseHeaders(data), nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return value.([]headerRule), nil
+}
+
+// downloadSiteFile downloads a small configuration object, such as
+// _redirects, from the hosted root. It returns no data and no error if the
+// object doesn't exist or the access doesn't permit reading it.
+func downloadSiteFile(ctx context.Context, project *uplink.Project, root, name string) (data []byte, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	bucket, key := determineBucketAndObjectKey(root, "/"+name)
+	download, err := project.DownloadObject(ctx, bucket, key, nil)
+	if err != nil {
+		if errors.Is(err, uplink.ErrObjectNotFound) || errors.Is(err, uplink.ErrPermissionDenied) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { err = errs.Combine(err, download.Close()) }()
+
+	return ioutil.ReadAll(io.LimitReader(download, maxSiteFileSize.Int64()))
 }
 
 // determineBucketAndObjectKey is a helper function to parse storj_root and the url into the bucket and object key.
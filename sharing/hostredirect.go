@@ -0,0 +1,77 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// hostRedirect redirects every request of a hosted domain to another URL, for
+// example for redirecting www.example.test to example.test.
+type hostRedirect struct {
+	target *url.URL
+	// preservePath appends the path and query of the request to the target.
+	preservePath bool
+	status       int
+}
+
+// parseHostRedirect parses the storj-redirect fields of a TXT record set. It
+// returns nil if the set has no redirect.
+func parseHostRedirect(set *TXTRecordSet) (*hostRedirect, error) {
+	target := strings.TrimSpace(set.Lookup("storj-redirect"))
+	if target == "" {
+		return nil, nil
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, WithStatus(errs.New("invalid redirect target %q", target), http.StatusBadRequest)
+	}
+
+	status := http.StatusMovedPermanently
+	if value := strings.TrimSpace(set.Lookup("storj-redirect-status")); value != "" {
+		status, err = strconv.Atoi(value)
+		if err != nil || !isRedirectStatus(status) {
+			return nil, WithStatus(errs.New("invalid redirect status %q", value), http.StatusBadRequest)
+		}
+	}
+
+	return &hostRedirect{
+		target:       parsed,
+		preservePath: lookupFlag(set, "storj-redirect-path", true),
+		status:       status,
+	}, nil
+}
+
+// isRedirectStatus reports whether status may be used for host redirects.
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// location returns the URL r is redirected to.
+func (redirect *hostRedirect) location(r *http.Request) string {
+	if !redirect.preservePath {
+		return redirect.target.String()
+	}
+
+	location := *redirect.target
+	location.Path = strings.TrimSuffix(location.Path, "/") + r.URL.Path
+	location.RawPath = ""
+	switch {
+	case location.RawQuery == "":
+		location.RawQuery = r.URL.RawQuery
+	case r.URL.RawQuery != "":
+		location.RawQuery += "&" + r.URL.RawQuery
+	}
+	return location.String()
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostRedirect(t *testing.T) {
+	parse := func(fields ...string) (*hostRedirect, error) {
+		set := NewTXTRecordSet()
+		for _, field := range fields {
+			set.Add(field, time.Hour)
+		}
+		set.Finalize()
+		return parseHostRedirect(set)
+	}
+
+	redirect, err := parse("storj-root:bucket")
+	require.NoError(t, err)
+	require.Nil(t, redirect)
+
+	for _, invalid := range [][]string{
+		{"storj-redirect:example.test"},
+		{"storj-redirect:ftp://example.test"},
+		{"storj-redirect:https://example.test", "storj-redirect-status:200"},
+	} {
+		_, err := parse(invalid...)
+		require.Error(t, err, invalid)
+	}
+
+	for _, test := range []struct {
+		fields   []string
+		request  string
+		location string
+		status   int
+	}{
+		{
+			fields:   []string{"storj-redirect:https://example.test"},
+			request:  "http://www.example.test/docs/page.html?q=1",
+			location: "https://example.test/docs/page.html?q=1",
+			status:   http.StatusMovedPermanently,
+		},
+		{
+			fields:   []string{"storj-redirect:https://example.test/new/?src=www", "storj-redirect-status:308"},
+			request:  "http://www.example.test/docs/?q=1",
+			location: "https://example.test/new/docs/?src=www&q=1",
+			status:   http.StatusPermanentRedirect,
+		},
+		{
+			fields:   []string{"storj-redirect:https://example.test/moved.html", "storj-redirect-path:off"},
+			request:  "http://www.example.test/docs/?q=1",
+			location: "https://example.test/moved.html",
+			status:   http.StatusMovedPermanently,
+		},
+	} {
+		redirect, err := parse(test.fields...)
+		require.NoError(t, err, test.fields)
+		require.Equal(t, test.status, redirect.status, test.fields)
+		require.Equal(t, test.location, redirect.location(httptest.NewRequest(http.MethodGet, test.request, nil)), test.fields)
+	}
+}
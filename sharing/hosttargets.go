@@ -0,0 +1,205 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/zeebo/errs"
+)
+
+// hostTargetAddrsTTL is how long the addresses of the hosts of the URL bases
+// are cached.
+const hostTargetAddrsTTL = 5 * time.Minute
+
+// hostTargets are what hosted domains have to resolve to for being served:
+// the hosts of the URL bases, by CNAME or by sharing their addresses, and
+// allowlisted networks for installations behind load balancers or proxies.
+type hostTargets struct {
+	hosts []string
+	nets  []*net.IPNet
+
+	mu    sync.Mutex
+	addrs map[string]hostTargetAddrs
+}
+
+// hostTargetAddrs are the cached addresses of a host of the URL bases.
+type hostTargetAddrs struct {
+	addrs      []net.IP
+	expiration time.Time
+}
+
+// newHostTargets returns the targets for the hosts of bases and addresses,
+// which are IP addresses or networks in CIDR notation.
+func newHostTargets(bases []*url.URL, addresses []string) (*hostTargets, error) {
+	targets := &hostTargets{}
+	for _, base := range bases {
+		targets.hosts = append(targets.hosts, strings.ToLower(base.Hostname()))
+	}
+	for _, address := range addresses {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, errs.New("invalid host target address %q", address)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			targets.nets = append(targets.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, errs.New("invalid host target address %q: %w", address, err)
+		}
+		targets.nets = append(targets.nets, network)
+	}
+	return targets, nil
+}
+
+// match reports whether hostname resolves to one of the targets, describing
+// how it does or what it resolves to instead. Hosts of the URL bases that
+// fail to resolve are skipped, and it only fails if none of them resolved.
+func (targets *hostTargets) match(ctx context.Context, cli *DNSClient, hostname string) (ok bool, detail string, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	cnames, addrs, err := resolveHost(ctx, cli, hostname)
+	if err != nil {
+		return false, "", err
+	}
+	for _, cname := range cnames {
+		for _, host := range targets.hosts {
+			if cname == host {
+				return true, fmt.Sprintf("%s is a CNAME for %s", hostname, cname), nil
+			}
+		}
+	}
+	for _, addr := range addrs {
+		for _, network := range targets.nets {
+			if network.Contains(addr) {
+				return true, fmt.Sprintf("%s resolves to the allowlisted address %s", hostname, addr), nil
+			}
+		}
+	}
+	var resolveErrs errs.Group
+	for _, host := range targets.hosts {
+		hostAddrs, err := targets.lookupAddrs(ctx, cli, host)
+		if err != nil {
+			resolveErrs.Add(err)
+			continue
+		}
+		if sharesAddress(addrs, hostAddrs) {
+			return true, fmt.Sprintf("%s resolves to the addresses of %s", hostname, host), nil
+		}
+	}
+	if len(targets.hosts) > 0 && len(resolveErrs) == len(targets.hosts) {
+		return false, "", resolveErrs.Err()
+	}
+
+	switch {
+	case len(cnames) > 0:
+		return false, fmt.Sprintf("%s is a CNAME for %s instead of the link sharing service", hostname, strings.Join(cnames, ", ")), nil
+	case len(addrs) > 0:
+		return false, fmt.Sprintf("%s resolves to %v, which aren't addresses of the link sharing service", hostname, addrs), nil
+	default:
+		return false, fmt.Sprintf("%s doesn't resolve", hostname), nil
+	}
+}
+
+// lookupAddrs returns the addresses of host, a host of the URL bases, which
+// are cached for hostTargetAddrsTTL so that they aren't resolved for every
+// hostname that's verified.
+func (targets *hostTargets) lookupAddrs(ctx context.Context, cli *DNSClient, host string) (_ []net.IP, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	targets.mu.Lock()
+	cached, ok := targets.addrs[host]
+	targets.mu.Unlock()
+	if ok && time.Now().Before(cached.expiration) {
+		return cached.addrs, nil
+	}
+
+	_, addrs, err := resolveHost(ctx, cli, host)
+	if err != nil {
+		return nil, err
+	}
+
+	targets.mu.Lock()
+	if targets.addrs == nil {
+		targets.addrs = make(map[string]hostTargetAddrs)
+	}
+	targets.addrs[host] = hostTargetAddrs{addrs: addrs, expiration: time.Now().Add(hostTargetAddrsTTL)}
+	targets.mu.Unlock()
+	return addrs, nil
+}
+
+// verify returns an error unless hostname resolves to one of the targets. If
+// it doesn't, the error has status 421 Misdirected Request.
+func (targets *hostTargets) verify(ctx context.Context, cli *DNSClient, hostname string) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	ok, detail, err := targets.match(ctx, cli, hostname)
+	if err != nil {
+		return errs.New("unable to verify where hostname %q resolves to: %w", hostname, err)
+	}
+	if !ok {
+		mon.Event("host_target_mismatch")
+		return WithStatus(errs.New("%s", detail), http.StatusMisdirectedRequest)
+	}
+	return nil
+}
+
+// resolveHost looks up the CNAME targets of hostname, including the chain of
+// CNAMEs followed by the resolver, and the addresses it resolves to.
+func resolveHost(ctx context.Context, cli *DNSClient, hostname string) (cnames []string, addrs []net.IP, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	seen := make(map[string]bool)
+	for _, recordType := range []uint16{dns.TypeCNAME, dns.TypeA, dns.TypeAAAA} {
+		r, err := cli.Lookup(ctx, hostname, recordType)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, answer := range r.Answer {
+			switch record := answer.(type) {
+			case *dns.CNAME:
+				cname := strings.ToLower(strings.TrimSuffix(record.Target, "."))
+				if !seen[cname] {
+					seen[cname] = true
+					cnames = append(cnames, cname)
+				}
+			case *dns.A:
+				addrs = append(addrs, record.A)
+			case *dns.AAAA:
+				addrs = append(addrs, record.AAAA)
+			}
+		}
+	}
+	return cnames, addrs, nil
+}
+
+// sharesAddress reports whether a and b have an address in common.
+func sharesAddress(a, b []net.IP) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Equal(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+func TestNewHostTargets(t *testing.T) {
+	targets, err := newHostTargets([]*url.URL{{Scheme: "https", Host: "Link.example.test:8443"}},
+		[]string{"192.0.2.1", " 198.51.100.0/24", "", "2001:db8::1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"link.example.test"}, targets.hosts)
+	require.Len(t, targets.nets, 3)
+	require.True(t, targets.nets[0].Contains(net.ParseIP("192.0.2.1")))
+	require.False(t, targets.nets[0].Contains(net.ParseIP("192.0.2.2")))
+	require.True(t, targets.nets[1].Contains(net.ParseIP("198.51.100.7")))
+	require.True(t, targets.nets[2].Contains(net.ParseIP("2001:db8::1")))
+
+	for _, invalid := range []string{"192.0.2", "192.0.2.0/33", "link.example.test"} {
+		_, err := newHostTargets(nil, []string{invalid})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestVerifyHostTargets(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 60}
+	}
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		q := m.Question[0]
+		switch {
+		case q.Name == "chained.test." && q.Qtype == dns.TypeCNAME:
+			r.Answer = append(r.Answer, &dns.CNAME{Hdr: header(q.Name, dns.TypeCNAME), Target: "www.customer.test."})
+		case q.Name == "chained.test." && q.Qtype == dns.TypeA:
+			// the resolver follows the chain of CNAMEs.
+			r.Answer = append(r.Answer,
+				&dns.CNAME{Hdr: header(q.Name, dns.TypeCNAME), Target: "www.customer.test."},
+				&dns.CNAME{Hdr: header("www.customer.test.", dns.TypeCNAME), Target: "link.example.test."},
+				&dns.A{Hdr: header("link.example.test.", dns.TypeA), A: net.IPv4(192, 0, 2, 1)})
+		case q.Name == "balanced.test." && q.Qtype == dns.TypeA:
+			r.Answer = append(r.Answer, &dns.A{Hdr: header(q.Name, dns.TypeA), A: net.IPv4(198, 51, 100, 7)})
+		case q.Name == "fronted.test." && q.Qtype == dns.TypeCNAME:
+			r.Answer = append(r.Answer, &dns.CNAME{Hdr: header(q.Name, dns.TypeCNAME), Target: "other-provider.test."})
+		case q.Name == "link.example.test." && q.Qtype == dns.TypeA:
+			r.Answer = append(r.Answer, &dns.A{Hdr: header(q.Name, dns.TypeA), A: net.IPv4(192, 0, 2, 1)})
+		case q.Qtype == dns.TypeTXT:
+			r.Answer = append(r.Answer, &dns.TXT{
+				Hdr: header(q.Name, dns.TypeTXT),
+				Txt: []string{"storj-root:bucket", "storj-access:" + serializedAccess},
+			})
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+
+	targets, err := newHostTargets([]*url.URL{{Scheme: "https", Host: "link.example.test"}}, []string{"198.51.100.0/24"})
+	require.NoError(t, err)
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour, targets: targets},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	for _, hostname := range []string{"chained.test", "balanced.test"} {
+		_, err := records.fetchAccessForHost(ctx, hostname, "")
+		require.NoError(t, err, hostname)
+		require.NoError(t, records.checkHost(ctx, hostname), hostname)
+	}
+
+	for _, hostname := range []string{"fronted.test", "unresolved.test"} {
+		_, err := records.fetchAccessForHost(ctx, hostname, "")
+		require.Error(t, err, hostname)
+		require.Equal(t, http.StatusMisdirectedRequest, GetStatus(err, 0), hostname)
+		require.Error(t, records.checkHost(ctx, hostname), hostname)
+	}
+}
+
+func TestHostTargetsMatch(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	var linkQueries int64
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		q := m.Question[0]
+		switch {
+		case q.Name == "down.example.test.":
+			return nil, errors.New("server failure")
+		case q.Name == "link.example.test.":
+			atomic.AddInt64(&linkQueries, 1)
+			if q.Qtype == dns.TypeA {
+				r.Answer = append(r.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 1),
+				})
+			}
+		case q.Name == "balanced.test." && q.Qtype == dns.TypeA:
+			r.Answer = append(r.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(192, 0, 2, 1),
+			})
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+	cli := &DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}
+
+	// a URL base that fails to resolve doesn't keep the others from being
+	// checked, and the addresses of the others are cached.
+	targets := &hostTargets{hosts: []string{"down.example.test", "link.example.test"}}
+	for i := 0; i < 2; i++ {
+		ok, _, err := targets.match(ctx, cli, "balanced.test")
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	require.EqualValues(t, 3, atomic.LoadInt64(&linkQueries))
+
+	// it can't tell if none of them resolve.
+	targets = &hostTargets{hosts: []string{"down.example.test"}}
+	_, _, err := targets.match(ctx, cli, "balanced.test")
+	require.Error(t, err)
+}
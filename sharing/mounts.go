@@ -0,0 +1,110 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/uplink"
+)
+
+const (
+	// mountField is the prefix of the TXT fields mounting a root at an URL
+	// path, such as storj-mount-/blog:bucket/posts.
+	mountField = "storj-mount-"
+	// mountAccessField is the prefix of the TXT fields setting the access of
+	// a mount, such as storj-mount-access-/blog:<access>, without a trailing
+	// slash. Mounts without one use the access of the site.
+	mountAccessField = "storj-mount-access-"
+)
+
+// continuationSuffix matches the suffix of the names of TXT fields that are
+// parts of the value of another field, see TXTRecordSet.Lookup.
+var continuationSuffix = regexp.MustCompile(`-[0-9]+$`)
+
+// siteMount serves the URL paths under prefix from root instead of the root
+// of the site.
+type siteMount struct {
+	// prefix is the mounted URL path, without a trailing slash.
+	prefix string
+	root   string
+	// access is the access for root, or nil to use the access of the site.
+	access *uplink.Access
+	// accessKeyID is the access key access was resolved from, if any.
+	accessKeyID string
+}
+
+// parseMounts parses the mounts of a TXT record set. clientIP is the IP of the
+// client that originated the request, for resolving access keys.
+func parseMounts(ctx context.Context, set *TXTRecordSet, auth AuthServiceConfig, clientIP string) (mounts []siteMount, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	for _, name := range set.Fields(mountField + "/") {
+		// field names are case-insensitive and _ is the same as -, so the
+		// prefix has to be taken from the name normalized like
+		// TXTRecordSet.Add does, which the values of the field are looked up
+		// by.
+		key := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+		prefix := strings.TrimRight(key[len(mountField):], "/")
+		switch {
+		case prefix == "":
+			return nil, WithStatus(errs.New("invalid mount %q: use storj-root for the root of the site", name), http.StatusBadRequest)
+		case strings.Contains(prefix, "//") || strings.Contains("/"+prefix+"/", "/../"):
+			return nil, WithStatus(errs.New("invalid mount %q", name), http.StatusBadRequest)
+		case strings.Contains(name[len(mountField):], "_"):
+			return nil, WithStatus(errs.New("invalid mount %q: field names can't tell _ from -", name), http.StatusBadRequest)
+		case continuationSuffix.MatchString(prefix):
+			return nil, WithStatus(errs.New("invalid mount %q: a -<number> suffix continues the value of another field", name), http.StatusBadRequest)
+		case len(set.LookupAll(key)) > 1:
+			return nil, WithStatus(errs.New("conflicting mounts for %q: mount paths are case-insensitive", prefix), http.StatusBadRequest)
+		}
+
+		mount := siteMount{
+			prefix: prefix,
+			root:   strings.TrimSpace(set.Lookup(key)),
+		}
+		if mount.root == "" {
+			return nil, WithStatus(errs.New("mount %q has no root", name), http.StatusBadRequest)
+		}
+		if serializedAccess := set.Lookup(mountAccessField + prefix); serializedAccess != "" {
+			mount.access, err = parseAccess(ctx, serializedAccess, auth, clientIP)
+			if err != nil {
+				return nil, errs.New("mount %q: %w", name, err)
+			}
+			if !isAccessGrant(serializedAccess) {
+				mount.accessKeyID = serializedAccess
+			}
+		}
+		mounts = append(mounts, mount)
+	}
+
+	// longest prefixes first, so the first match is the longest one.
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].prefix) > len(mounts[j].prefix)
+	})
+	return mounts, nil
+}
+
+// matchMount returns the mount with the longest prefix containing urlPath and
+// the path relative to it, or nil if urlPath isn't under any mount. Prefixes
+// are matched case-insensitively, like the TXT fields they come from.
+func matchMount(mounts []siteMount, urlPath string) (mount *siteMount, relativePath string) {
+	lowerPath := strings.ToLower(urlPath)
+	for i := range mounts {
+		prefix := mounts[i].prefix
+		if lowerPath == prefix {
+			return &mounts[i], "/"
+		}
+		if strings.HasPrefix(lowerPath, prefix+"/") {
+			return &mounts[i], urlPath[len(prefix):]
+		}
+	}
+	return nil, urlPath
+}
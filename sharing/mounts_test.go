@@ -0,0 +1,75 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+func TestParseMounts(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	set := NewTXTRecordSet()
+	set.Add("storj-root:site", time.Hour)
+	set.Add("storj-mount-/Blog:bucket2/posts", time.Hour)
+	set.Add("storj_mount-/assets/:cdn-bucket", time.Hour)
+	set.Add("storj-mount-/assets/fonts:fonts", time.Hour)
+	set.Add("storj-mount-access-/assets-1:"+serializedAccess[:10], time.Hour)
+	set.Add("storj-mount-access-/assets-2:"+serializedAccess[10:], time.Hour)
+	set.Finalize()
+
+	mounts, err := parseMounts(ctx, set, AuthServiceConfig{}, "")
+	require.NoError(t, err)
+	require.Len(t, mounts, 3)
+	require.Equal(t, "/assets/fonts", mounts[0].prefix)
+	require.Equal(t, "fonts", mounts[0].root)
+	require.Nil(t, mounts[0].access)
+	require.NotNil(t, mounts[1].access)
+
+	for _, test := range []struct {
+		urlPath  string
+		prefix   string
+		relative string
+	}{
+		{urlPath: "/Blog/2021/post.html", prefix: "/blog", relative: "/2021/post.html"},
+		{urlPath: "/blog", prefix: "/blog", relative: "/"},
+		{urlPath: "/Blogger/index.html", relative: "/Blogger/index.html"},
+		{urlPath: "/assets/site.css", prefix: "/assets", relative: "/site.css"},
+		{urlPath: "/assets/fonts/a.woff", prefix: "/assets/fonts", relative: "/a.woff"},
+		{urlPath: "/index.html", relative: "/index.html"},
+	} {
+		mount, relative := matchMount(mounts, test.urlPath)
+		if test.prefix == "" {
+			require.Nil(t, mount, test.urlPath)
+		} else {
+			require.NotNil(t, mount, test.urlPath)
+			require.Equal(t, test.prefix, mount.prefix, test.urlPath)
+		}
+		require.Equal(t, test.relative, relative, test.urlPath)
+	}
+
+	for _, invalid := range [][]string{
+		{"storj-mount-/:bucket"},
+		{"storj-mount-/a/../b:bucket"},
+		{"storj-mount-/a:"},
+		{"storj-mount-/my_blog:bucket"},
+		{"storj-mount-/v-1:bucket"},
+		{"storj-mount-/Blog:bucket", "storj-mount-/blog:bucket2"},
+		{"storj-mount-/my-blog:bucket", "storj-mount-/my_blog:bucket2"},
+	} {
+		set := NewTXTRecordSet()
+		for _, record := range invalid {
+			set.Add(record, time.Hour)
+		}
+		set.Finalize()
+		_, err := parseMounts(ctx, set, AuthServiceConfig{}, "")
+		require.Error(t, err, invalid)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/zeebo/errs"
 	"go.uber.org/zap"
@@ -29,6 +30,23 @@ type parsedRequest struct {
 	root            breadcrumb
 	wrapDefault     bool
 	downloadDefault bool
+
+	// indexFiles are the names of the objects that are looked up, in order,
+	// when a prefix is requested.
+	indexFiles []string
+	// cleanURLs enables serving key.html when key is requested but doesn't
+	// exist. Otherwise, a key/ with an index document is redirected to, so
+	// that relative links of the index document keep working.
+	cleanURLs bool
+	// hideListing disables listing the objects of a prefix, so that only
+	// index documents are served.
+	hideListing bool
+	// hideMap disables the ?map view of objects.
+	hideMap bool
+
+	// header contains additional headers to set when serving the object
+	// itself, such as the ones from a hosted site's _headers object.
+	header http.Header
 }
 
 func (handler *Handler) present(ctx context.Context, w http.ResponseWriter, r *http.Request, pr *parsedRequest) (err error) {
@@ -50,7 +68,7 @@ func (handler *Handler) present(ctx context.Context, w http.ResponseWriter, r *h
 func (handler *Handler) presentWithProject(ctx context.Context, w http.ResponseWriter, r *http.Request, pr *parsedRequest, project *uplink.Project) (err error) {
 	defer mon.Task()(&ctx)(&err)
 
-	// first, kick off background index.html request, if appropriate. we do this
+	// first, kick off background index request, if appropriate. we do this
 	// to cut down on sequential round trips.
 	type statResult struct {
 		obj *uplink.Object
@@ -62,13 +80,13 @@ func (handler *Handler) presentWithProject(ctx context.Context, w http.ResponseW
 
 	if pr.realKey == "" || strings.HasSuffix(pr.realKey, "/") {
 		go func() {
-			obj, err := project.StatObject(ctx, pr.bucket, pr.realKey+"index.html")
+			obj, err := statIndex(ctx, project, pr.bucket, pr.realKey, pr.indexFiles)
 			indexResultCh <- statResult{obj: obj, err: err}
 		}()
 	} else {
 		// make sure we've always sent a result
 		indexResultCh <- statResult{err: errs.New(
-			"unreachable, index.html lookup incorrectly expected")}
+			"unreachable, index lookup incorrectly expected")}
 	}
 
 	if pr.realKey != "" { // there are no objects with the empty key
@@ -82,6 +100,16 @@ func (handler *Handler) presentWithProject(ctx context.Context, w http.ResponseW
 		if !strings.HasSuffix(pr.realKey, "/") {
 			objNotFoundErr := WithAction(err, "stat object")
 
+			if pr.cleanURLs {
+				o, err := project.StatObject(ctx, pr.bucket, pr.realKey+".html")
+				if err == nil {
+					return handler.showObject(ctx, w, r, pr, project, o)
+				}
+				if !errors.Is(err, uplink.ErrObjectNotFound) {
+					return WithAction(err, "stat object - clean url")
+				}
+			}
+
 			// s3 has interesting behavior, which is if the object doesn't exist
 			// but is a prefix, it will issue a redirect to have a trailing slash.
 			isPrefix, err := handler.isPrefix(ctx, project, pr)
@@ -99,14 +127,14 @@ func (handler *Handler) presentWithProject(ctx context.Context, w http.ResponseW
 	}
 
 	// due to the above logic, if we reach this, the key is either exactly "" or ends in a "/",
-	// so we should be able to read the index.html StatObject channel
+	// so we should be able to read the index StatObject channel
 	indexResult := <-indexResultCh
 	o, err := indexResult.obj, indexResult.err
 	if err == nil {
 		return handler.showObject(ctx, w, r, pr, project, o)
 	}
 	if !errors.Is(err, uplink.ErrObjectNotFound) {
-		return WithAction(err, "stat object - index.html")
+		return WithAction(err, "stat object - index")
 	}
 
 	// special case for if the user requested a bucket but there's no trailing slash
@@ -115,6 +143,10 @@ func (handler *Handler) presentWithProject(ctx context.Context, w http.ResponseW
 		return nil
 	}
 
+	if pr.hideListing {
+		return WithAction(uplink.ErrObjectNotFound, "serve prefix - listing disabled")
+	}
+
 	return handler.servePrefix(ctx, w, project, pr)
 }
 
@@ -123,7 +155,7 @@ func (handler *Handler) showObject(ctx context.Context, w http.ResponseWriter, r
 
 	q := r.URL.Query()
 
-	if queryFlagLookup(q, "map", false) {
+	if !pr.hideMap && queryFlagLookup(q, "map", false) {
 		return handler.serveMap(ctx, w, pr, o, q)
 	}
 
@@ -146,6 +178,9 @@ func (handler *Handler) showObject(ctx context.Context, w http.ResponseWriter, r
 		} else {
 			w.Header().Set("Content-Type", "application/octet-stream")
 		}
+		for name, values := range pr.header {
+			w.Header()[name] = values
+		}
 
 		httpranger.ServeContent(ctx, w, r, o.Key, o.System.Created, objectranger.New(project, o, pr.bucket))
 		return nil
@@ -167,14 +202,18 @@ func (handler *Handler) showObject(ctx context.Context, w http.ResponseWriter, r
 
 func (handler *Handler) isPrefix(ctx context.Context, project *uplink.Project, pr *parsedRequest) (bool, error) {
 	// we might not having listing permission. if this is the case,
-	// guess that we're looking for an index.html and look for that.
-	_, err := project.StatObject(ctx, pr.bucket, pr.realKey+"/index.html")
+	// guess that we're looking for an index document and look for that.
+	_, err := statIndex(ctx, project, pr.bucket, pr.realKey+"/", pr.indexFiles)
 	if err == nil {
 		return true, nil
 	}
 	if !errors.Is(err, uplink.ErrObjectNotFound) {
 		return false, WithAction(err, "prefix determination stat")
 	}
+	if pr.hideListing {
+		// without an index document there's nothing to redirect to.
+		return false, nil
+	}
 
 	// we need to do a brief list to find out if this object is a prefix.
 	it := project.ListObjects(ctx, pr.bucket, &uplink.ListObjectsOptions{
@@ -191,3 +230,34 @@ func (handler *Handler) isPrefix(ctx context.Context, project *uplink.Project, p
 	}
 	return isPrefix, nil
 }
+
+// statIndex looks up the index documents named by indexFiles under prefix
+// concurrently, returning the first one in order that exists. If none exist,
+// it returns uplink.ErrObjectNotFound.
+func statIndex(ctx context.Context, project *uplink.Project, bucket, prefix string, indexFiles []string) (_ *uplink.Object, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	if len(indexFiles) == 0 {
+		indexFiles = defaultIndexFiles
+	}
+
+	objects := make([]*uplink.Object, len(indexFiles))
+	statErrs := make([]error, len(indexFiles))
+
+	var wg sync.WaitGroup
+	for i, name := range indexFiles {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			objects[i], statErrs[i] = project.StatObject(ctx, bucket, prefix+name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for i := range indexFiles {
+		if !errors.Is(statErrs[i], uplink.ErrObjectNotFound) {
+			return objects[i], statErrs[i]
+		}
+	}
+	return nil, statErrs[len(statErrs)-1]
+}
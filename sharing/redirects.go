@@ -0,0 +1,145 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redirectsFile is the name of the object in the hosted root that contains
+// redirect rules.
+const redirectsFile = "_redirects"
+
+// redirectRule is a single rule from a _redirects file.
+type redirectRule struct {
+	from   []string
+	to     string
+	status int
+}
+
+// parseRedirects parses a Netlify-style _redirects file. Every non-empty line
+// that isn't a comment has the form:
+//
+//     /from/:placeholder/*  /to/:placeholder/:splat  [status][!]
+//
+// The status defaults to 301 and may be one of 301, 302, 307, 308 or 200,
+// where 200 means the request is rewritten to the destination instead of
+// redirected. Rewrites must point at a path of the same site. A trailing
+// exclamation mark is accepted for compatibility but has no effect, as rules
+// are always applied before looking up the object. Invalid lines are ignored.
+func parseRedirects(data []byte) (rules []redirectRule) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 || !strings.HasPrefix(fields[0], "/") {
+			continue
+		}
+
+		rule := redirectRule{
+			from:   splitRedirectPath(fields[0]),
+			to:     fields[1],
+			status: http.StatusMovedPermanently,
+		}
+
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+			if err != nil {
+				continue
+			}
+			rule.status = status
+		}
+
+		switch rule.status {
+		case http.StatusMovedPermanently, http.StatusFound,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		case http.StatusOK:
+			if !strings.HasPrefix(rule.to, "/") || strings.HasPrefix(rule.to, "//") {
+				continue
+			}
+		default:
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matchRedirects returns the first rule that matches urlPath together with
+// its destination, with placeholders and the splat filled in.
+func matchRedirects(rules []redirectRule, urlPath string) (rule redirectRule, destination string, ok bool) {
+	segments := splitRedirectPath(urlPath)
+	for _, rule := range rules {
+		values, ok := matchRedirectPath(rule.from, segments)
+		if !ok {
+			continue
+		}
+		// replace longer names first so that :page doesn't clobber :pageid.
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+		destination := rule.to
+		for _, name := range names {
+			destination = strings.ReplaceAll(destination, ":"+name, values[name])
+		}
+		// browsers treat //host and /\host as URLs of another host, so
+		// e.g. a splat of /\host must not turn the rule into an open redirect.
+		if strings.HasPrefix(destination, "//") || strings.HasPrefix(destination, "/\\") {
+			continue
+		}
+		return rule, destination, true
+	}
+	return redirectRule{}, "", false
+}
+
+// matchRedirectPath matches path segments against pattern segments. A
+// segment starting with a colon matches any single segment and a final
+// asterisk matches the rest of the path, which is returned as "splat".
+func matchRedirectPath(pattern, segments []string) (values map[string]string, ok bool) {
+	values = map[string]string{}
+	for i, part := range pattern {
+		if part == "*" && i == len(pattern)-1 {
+			if i < len(segments) {
+				values["splat"] = strings.Join(segments[i:], "/")
+			} else {
+				values["splat"] = ""
+			}
+			return values, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(part, ":") && len(part) > 1:
+			values[part[1:]] = segments[i]
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	return values, len(pattern) == len(segments)
+}
+
+// splitRedirectPath splits a path into its non-empty segments, so that /about,
+// /about/ and //about are treated the same.
+func splitRedirectPath(urlPath string) (segments []string) {
+	for _, segment := range strings.Split(urlPath, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
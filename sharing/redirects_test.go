@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedirects(t *testing.T) {
+	rules := parseRedirects([]byte(`
+# comments and blank lines are ignored
+
+/old            /new
+/temp           /elsewhere      302
+/forced         /target         308!
+/app/*          /index.html     200
+/external       https://example.test/
+/bad-status     /somewhere      418
+/proxy          https://example.test/ 200
+relative        /somewhere
+/too /many /fields /here
+`))
+
+	require.Len(t, rules, 5)
+	assert.Equal(t, []string{"old"}, rules[0].from)
+	assert.Equal(t, "/new", rules[0].to)
+	assert.Equal(t, http.StatusMovedPermanently, rules[0].status)
+	assert.Equal(t, http.StatusFound, rules[1].status)
+	assert.Equal(t, http.StatusPermanentRedirect, rules[2].status)
+	assert.Equal(t, http.StatusOK, rules[3].status)
+	assert.Equal(t, "https://example.test/", rules[4].to)
+}
+
+func TestMatchRedirects(t *testing.T) {
+	rules := parseRedirects([]byte(`
+/news/:year/:month/:slug   /blog/:year/:slug
+/docs/*                    /documentation/:splat   302
+/page/:page/:pageid        /p/:pageid/:page
+/about                     /about-us
+/spa/*                     /spa/index.html         200
+/old/*                     /:splat
+/moved/:page               /:page                  200
+`))
+
+	for _, test := range []struct {
+		path        string
+		destination string
+		status      int
+		ok          bool
+	}{
+		{path: "/news/2021/06/hello", destination: "/blog/2021/hello", status: 301, ok: true},
+		{path: "/news/2021/06", ok: false},
+		{path: "/news/2021/06/hello/extra", ok: false},
+		{path: "/docs/a/b/c.html", destination: "/documentation/a/b/c.html", status: 302, ok: true},
+		{path: "/docs", destination: "/documentation/", status: 302, ok: true},
+		{path: "/page/1/2", destination: "/p/2/1", status: 301, ok: true},
+		{path: "/about", destination: "/about-us", status: 301, ok: true},
+		{path: "/about/", destination: "/about-us", status: 301, ok: true},
+		{path: "/about/team", ok: false},
+		{path: "/spa/dashboard/settings", destination: "/spa/index.html", status: 200, ok: true},
+		{path: "/", ok: false},
+		{path: "/old/a/b", destination: "/a/b", status: 301, ok: true},
+		{path: "/old//evil.test", destination: "/evil.test", status: 301, ok: true},
+		{path: "/old/\\evil.test", ok: false},
+		{path: "/moved/\\evil.test", ok: false},
+		{path: "//about", destination: "/about-us", status: 301, ok: true},
+	} {
+		rule, destination, ok := matchRedirects(rules, test.path)
+		require.Equal(t, test.ok, ok, test.path)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, test.destination, destination, test.path)
+		assert.Equal(t, test.status, rule.status, test.path)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+const (
+	// defaultRefreshWorkers is the number of refresh workers used when the
+	// configuration doesn't set it.
+	defaultRefreshWorkers = 4
+	// refreshQueueSize is the number of refreshes that may wait for a worker.
+	// Refreshes beyond it are dropped and retried on the next cache hit.
+	refreshQueueSize = 1024
+	// refreshTimeout bounds how long a single refresh may take.
+	refreshTimeout = 30 * time.Second
+)
+
+// txtRefresher refreshes cached txt records in the background using a bounded
+// number of workers. Refreshes of the same hostname are deduplicated. It also
+// periodically revalidates the cached records resolved from access keys, see
+// revalidateEvery.
+type txtRefresher struct {
+	records *txtRecords
+	workers int
+	queue   chan txtRefresh
+
+	mu      sync.Mutex
+	running bool
+	pending map[string]struct{}
+}
+
+// txtRefresh is a request to refresh the cache entry of a hostname.
+type txtRefresh struct {
+	hostname string
+	entry    *txtCacheEntry
+	clientIP string
+}
+
+func newTxtRefresher(records *txtRecords, workers int) *txtRefresher {
+	if workers <= 0 {
+		workers = defaultRefreshWorkers
+	}
+	return &txtRefresher{
+		records: records,
+		workers: workers,
+		queue:   make(chan txtRefresh, refreshQueueSize),
+		pending: map[string]struct{}{},
+	}
+}
+
+// Run refreshes the queued entries until ctx is canceled. It waits for the
+// refreshes in progress to be aborted before returning.
+func (refresher *txtRefresher) Run(ctx context.Context) error {
+	refresher.mu.Lock()
+	if refresher.running {
+		refresher.mu.Unlock()
+		return errs.New("txt record refresher is already running")
+	}
+	refresher.running = true
+	refresher.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < refresher.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refresher.work(ctx)
+		}()
+	}
+	if interval := refresher.records.config.revalidateInterval; interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refresher.revalidateEvery(ctx, interval)
+		}()
+	}
+	wg.Wait()
+
+	// drop the refreshes that didn't get a chance to run. the entries are
+	// refreshed synchronously until the refresher runs again.
+	refresher.mu.Lock()
+	defer refresher.mu.Unlock()
+	refresher.running = false
+	refresher.pending = map[string]struct{}{}
+	for {
+		select {
+		case <-refresher.queue:
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+func (refresher *txtRefresher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case refresh := <-refresher.queue:
+			refresher.refresh(ctx, refresh)
+		}
+	}
+}
+
+func (refresher *txtRefresher) refresh(ctx context.Context, refresh txtRefresh) {
+	defer func() {
+		refresher.mu.Lock()
+		delete(refresher.pending, refresh.hostname)
+		refresher.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	_, _ = refresher.records.updateCache(ctx, refresh.hostname, refresh.entry, refresh.clientIP)
+}
+
+// revalidateEvery revalidates the cached records resolved from access keys
+// every interval until ctx is canceled. Revalidations don't go through the
+// refresh queue, so that they don't delay refreshes, and each pass is spread
+// over the interval, so that the auth service sees a steady rate of requests
+// rather than a burst.
+func (refresher *txtRefresher) revalidateEvery(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		start := time.Now()
+
+		type revalidation struct {
+			hostname string
+			entry    *txtCacheEntry
+		}
+		var revalidations []revalidation
+		refresher.records.cache.Range(func(hostname string, entry *txtCacheEntry) {
+			if entry.record != nil && len(entry.record.accessKeyIDs()) > 0 {
+				revalidations = append(revalidations, revalidation{hostname: hostname, entry: entry})
+			}
+		})
+
+		pace := interval / time.Duration(len(revalidations)+1)
+		for _, revalidation := range revalidations {
+			timer.Reset(pace)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			revalidateCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+			_ = refresher.records.revalidateAccess(revalidateCtx, revalidation.hostname, revalidation.entry)
+			cancel()
+		}
+
+		// a pass that took longer than the interval is followed by the next
+		// one right away.
+		timer.Reset(interval - time.Since(start))
+	}
+}
+
+// enqueue queues a refresh of the entry of hostname unless one is already
+// queued. It returns false if the refresher isn't running, in which case the
+// caller needs to refresh the entry itself.
+func (refresher *txtRefresher) enqueue(hostname string, entry *txtCacheEntry, clientIP string) bool {
+	refresher.mu.Lock()
+	defer refresher.mu.Unlock()
+
+	if !refresher.running {
+		return false
+	}
+	if _, ok := refresher.pending[hostname]; ok {
+		return true
+	}
+
+	select {
+	case refresher.queue <- txtRefresh{hostname: hostname, entry: entry, clientIP: clientIP}:
+		refresher.pending[hostname] = struct{}{}
+	default:
+		mon.Event("txt_record_refresh_dropped")
+	}
+	return true
+}
+
+// refreshLead returns how long before its expiration a record with the given
+// ttl is refreshed. It's jittered between 10% and 20% of the ttl so that
+// records cached at the same time aren't refreshed all at once.
+func refreshLead(ttl time.Duration) time.Duration {
+	lead := ttl / 10
+	if lead <= 0 {
+		return 0
+	}
+	return lead + time.Duration(rand.Int63n(int64(lead)+1))
+}
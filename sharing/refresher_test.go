@@ -0,0 +1,225 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+func TestTxtRefresher(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	var queries int64
+	release := make(chan struct{}, 10)
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		// the other names of the TXT records are looked up concurrently.
+		if m.Question[0].Name != "txt-site.test." {
+			r.Rcode = dns.RcodeNameError
+			return r, nil
+		}
+		atomic.AddInt64(&queries, 1)
+		<-release
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"storj-root:bucket", "storj-access:" + serializedAccess},
+		})
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	release <- struct{}{}
+	record, err := records.fetchAccessForHost(ctx, "site.test", "")
+	require.NoError(t, err)
+
+	expire := func() *txtCacheEntry {
+		entry, ok := records.cache.Peek("site.test")
+		require.True(t, ok)
+		expired := *entry
+		expired.expiration = time.Now().Add(-time.Second)
+		expired.refreshAt = expired.expiration
+		records.cache.Store("site.test", &expired)
+		return &expired
+	}
+
+	// without the refresher running, expired records are refreshed before
+	// returning.
+	expire()
+	release <- struct{}{}
+	refreshed, err := records.fetchAccessForHost(ctx, "site.test", "")
+	require.NoError(t, err)
+	require.NotSame(t, record, refreshed)
+	require.EqualValues(t, 2, atomic.LoadInt64(&queries))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	ctx.Go(func() error {
+		err := records.Run(runCtx)
+		if runCtx.Err() != nil {
+			return nil
+		}
+		return err
+	})
+	require.Eventually(t, func() bool {
+		records.refresher.mu.Lock()
+		defer records.refresher.mu.Unlock()
+		return records.refresher.running
+	}, 10*time.Second, time.Millisecond)
+
+	// with the refresher running, expired records are served while a single
+	// refresh happens in the background.
+	expired := expire()
+	for i := 0; i < 3; i++ {
+		got, err := records.fetchAccessForHost(ctx, "site.test", "")
+		require.NoError(t, err)
+		require.Same(t, refreshed, got)
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&queries) == 3
+	}, 10*time.Second, time.Millisecond)
+	release <- struct{}{}
+	require.Eventually(t, func() bool {
+		entry, ok := records.cache.Peek("site.test")
+		return ok && entry != expired
+	}, 10*time.Second, time.Millisecond)
+	require.EqualValues(t, 3, atomic.LoadInt64(&queries))
+
+	cancel()
+}
+
+func TestRefreshLead(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		lead := refreshLead(time.Minute)
+		require.True(t, lead >= 6*time.Second && lead <= 12*time.Second, lead)
+	}
+	require.Zero(t, refreshLead(0))
+}
+
+func TestTxtRefresherRevalidatesAccessKeys(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	var revoked int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&revoked) != 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write([]byte(`{"public":true,"access_grant":"` + serializedAccess + `"}`))
+		require.NoError(t, err)
+	}))
+	defer authServer.Close()
+
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600},
+			Txt: []string{"storj-root:bucket", "storj-access:accesskeyid"},
+		})
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour, revalidateInterval: 10 * time.Millisecond},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}},
+		AuthServiceConfig{BaseURL: authServer.URL})
+
+	record, err := records.fetchAccessForHost(ctx, "site.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "accesskeyid", record.accessKeyID)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx.Go(func() error {
+		err := records.Run(runCtx)
+		if runCtx.Err() != nil {
+			return nil
+		}
+		return err
+	})
+
+	// valid access keys stay cached.
+	time.Sleep(50 * time.Millisecond)
+	_, ok := records.cache.Peek("site.test")
+	require.True(t, ok)
+
+	// revoked access keys are evicted without waiting for the ttl.
+	atomic.StoreInt32(&revoked, 1)
+	require.Eventually(t, func() bool {
+		_, ok := records.cache.Peek("site.test")
+		return !ok
+	}, 10*time.Second, time.Millisecond)
+
+	_, err = records.fetchAccessForHost(ctx, "site.test", "")
+	require.Error(t, err)
+}
+
+func TestRevalidateAccessOfMounts(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	statuses := map[string]int{
+		"/v1/access/sitekey":    http.StatusOK,
+		"/v1/access/mountkey":   http.StatusOK,
+		"/v1/access/limitedkey": http.StatusTooManyRequests,
+	}
+	var revoked int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[r.URL.Path]
+		if r.URL.Path == "/v1/access/mountkey" && atomic.LoadInt32(&revoked) != 0 {
+			status = http.StatusNotFound
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_, err := w.Write([]byte(`{"public":true,"access_grant":"` + serializedAccess + `"}`))
+		require.NoError(t, err)
+	}))
+	defer authServer.Close()
+
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour}, &DNSClient{}, AuthServiceConfig{BaseURL: authServer.URL})
+	store := func(hostname string, mountKey string) *txtCacheEntry {
+		entry := &txtCacheEntry{
+			record: &txtRecord{
+				accessKeyID: "sitekey",
+				mounts:      []siteMount{{prefix: "/docs", root: "docs", accessKeyID: mountKey}},
+			},
+			expiration: time.Now().Add(time.Hour),
+		}
+		records.cache.Store(hostname, entry)
+		return entry
+	}
+
+	entry := store("site.test", "mountkey")
+	require.Equal(t, []string{"sitekey", "mountkey"}, entry.record.accessKeyIDs())
+	require.NoError(t, records.revalidateAccess(ctx, "site.test", entry))
+	_, ok := records.cache.Peek("site.test")
+	require.True(t, ok)
+
+	// failures other than revocations keep the entry.
+	limited := store("limited.test", "limitedkey")
+	require.Error(t, records.revalidateAccess(ctx, "limited.test", limited))
+	_, ok = records.cache.Peek("limited.test")
+	require.True(t, ok)
+
+	// a revoked access key of a mount evicts the entry.
+	atomic.StoreInt32(&revoked, 1)
+	require.NoError(t, records.revalidateAccess(ctx, "site.test", entry))
+	_, ok = records.cache.Peek("site.test")
+	require.False(t, ok)
+}
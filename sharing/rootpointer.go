@@ -0,0 +1,152 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/common/memory"
+	"storj.io/uplink"
+)
+
+// maxRootPointerSize is the maximum size of a root pointer object.
+const maxRootPointerSize = memory.KiB
+
+// siteRoot is a root a hosted site is served from.
+type siteRoot struct {
+	root string
+
+	// redirects and headers cache the rules parsed from the _redirects and
+	// _headers objects in the root. they are loaded on first use and live as
+	// long as the root is served.
+	redirects lazyValue
+	headers   lazyValue
+}
+
+// rootPointer resolves the root of a hosted site from the contents of an
+// object, which name the prefix of the active deploy in the bucket of the
+// object. Switching deploys is then a single upload that takes effect within
+// ttl, independent of the TTL of the txt records.
+type rootPointer struct {
+	bucket string
+	key    string
+	ttl    time.Duration
+
+	mu         sync.Mutex
+	current    *siteRoot
+	expiration time.Time
+	refreshing bool
+}
+
+// parseRootPointer parses the storj-root-pointer field of a TXT record set,
+// replacing the subdomain placeholder for wildcard records. It returns nil if
+// the set has no root pointer.
+func parseRootPointer(set *TXTRecordSet, subdomain string, ttl time.Duration) (*rootPointer, error) {
+	path := strings.TrimSpace(set.Lookup("storj-root-pointer"))
+	if path == "" {
+		return nil, nil
+	}
+	if subdomain != "" {
+		var err error
+		path, err = expandRoot(path, subdomain)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" || strings.HasSuffix(parts[1], "/") {
+		return nil, WithStatus(errs.New("invalid root pointer %q: must be bucket/key of an object", path), http.StatusBadRequest)
+	}
+	return &rootPointer{bucket: parts[0], key: parts[1], ttl: ttl}, nil
+}
+
+// resolve returns the root named by the pointer object, downloading it with
+// download once the previous contents expired. While one request downloads
+// it, others keep being served from the current root, which also is kept if
+// the download fails for another reason than the object missing.
+func (pointer *rootPointer) resolve(ctx context.Context, download func(ctx context.Context, bucket, key string) ([]byte, error)) (site *siteRoot, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	pointer.mu.Lock()
+	current := pointer.current
+	if current != nil && (pointer.refreshing || time.Now().Before(pointer.expiration)) {
+		pointer.mu.Unlock()
+		return current, nil
+	}
+	pointer.refreshing = true
+	pointer.mu.Unlock()
+
+	root, err := pointer.load(ctx, download)
+
+	pointer.mu.Lock()
+	defer pointer.mu.Unlock()
+	pointer.refreshing = false
+
+	switch {
+	case err == nil:
+		if pointer.current == nil || pointer.current.root != root {
+			if pointer.current != nil {
+				mon.Event("root_pointer_switched")
+			}
+			pointer.current = &siteRoot{root: root}
+		}
+	case pointer.current != nil && !errors.Is(err, uplink.ErrObjectNotFound):
+		mon.Event("root_pointer_stale")
+	default:
+		return nil, err
+	}
+	pointer.expiration = time.Now().Add(pointer.ttl)
+	return pointer.current, nil
+}
+
+// cached returns the root the pointer was last resolved to, or nil if it
+// wasn't resolved yet.
+func (pointer *rootPointer) cached() *siteRoot {
+	pointer.mu.Lock()
+	defer pointer.mu.Unlock()
+	return pointer.current
+}
+
+// load downloads the pointer object and returns the root it names.
+func (pointer *rootPointer) load(ctx context.Context, download func(ctx context.Context, bucket, key string) ([]byte, error)) (root string, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	data, err := download(ctx, pointer.bucket, pointer.key)
+	if err != nil {
+		return "", WithAction(err, "download root pointer")
+	}
+
+	prefix := strings.TrimPrefix(strings.TrimSpace(string(data)), "/")
+	if prefix == "" || strings.ContainsAny(prefix, "\r\n") || strings.Contains("/"+prefix+"/", "/../") {
+		return "", WithStatus(errs.New("invalid root pointer %s/%s: %q", pointer.bucket, pointer.key, prefix), http.StatusBadRequest)
+	}
+	return pointer.bucket + "/" + prefix, nil
+}
+
+// resolveSite returns the root the hosted site of record is currently served
+// from.
+func resolveSite(ctx context.Context, project *uplink.Project, record *txtRecord) (*siteRoot, error) {
+	if record.pointer == nil {
+		return record.site, nil
+	}
+	return record.pointer.resolve(ctx, func(ctx context.Context, bucket, key string) (_ []byte, err error) {
+		download, err := project.DownloadObject(ctx, bucket, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { err = errs.Combine(err, download.Close()) }()
+
+		return ioutil.ReadAll(io.LimitReader(download, maxRootPointerSize.Int64()))
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+	"storj.io/uplink"
+)
+
+func TestParseRootPointer(t *testing.T) {
+	parse := func(subdomain string, fields ...string) (*rootPointer, error) {
+		set := NewTXTRecordSet()
+		for _, field := range fields {
+			set.Add(field, time.Hour)
+		}
+		set.Finalize()
+		return parseRootPointer(set, subdomain, time.Second)
+	}
+
+	pointer, err := parse("", "storj-root:bucket")
+	require.NoError(t, err)
+	require.Nil(t, pointer)
+
+	pointer, err = parse("", "storj-root-pointer:site/CURRENT")
+	require.NoError(t, err)
+	require.Equal(t, "site", pointer.bucket)
+	require.Equal(t, "CURRENT", pointer.key)
+
+	pointer, err = parse("pr-42", "storj-root-pointer:previews/{subdomain}/CURRENT")
+	require.NoError(t, err)
+	require.Equal(t, "pr-42/CURRENT", pointer.key)
+
+	for _, invalid := range []string{"site", "site/", "/CURRENT", "site/deploys/"} {
+		_, err := parse("", "storj-root-pointer:"+invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestRootPointerResolve(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	var contents string
+	var downloadErr error
+	downloads := 0
+	download := func(ctx context.Context, bucket, key string) ([]byte, error) {
+		require.Equal(t, "site", bucket)
+		require.Equal(t, "CURRENT", key)
+		downloads++
+		return []byte(contents), downloadErr
+	}
+
+	pointer := &rootPointer{bucket: "site", key: "CURRENT", ttl: time.Hour}
+
+	contents = "deploys/1\n"
+	site, err := pointer.resolve(ctx, download)
+	require.NoError(t, err)
+	require.Equal(t, "site/deploys/1", site.root)
+
+	// the contents are cached for the ttl.
+	contents = "deploys/2"
+	cached, err := pointer.resolve(ctx, download)
+	require.NoError(t, err)
+	require.Same(t, site, cached)
+	require.Equal(t, 1, downloads)
+
+	// once expired, a new deploy is switched to.
+	pointer.expiration = time.Time{}
+	switched, err := pointer.resolve(ctx, download)
+	require.NoError(t, err)
+	require.Equal(t, "site/deploys/2", switched.root)
+	require.Equal(t, 2, downloads)
+
+	// the current deploy is kept while downloading fails.
+	pointer.expiration = time.Time{}
+	downloadErr = errors.New("unavailable")
+	stale, err := pointer.resolve(ctx, download)
+	require.NoError(t, err)
+	require.Same(t, switched, stale)
+
+	// but not once the pointer is gone.
+	pointer.expiration = time.Time{}
+	downloadErr = uplink.ErrObjectNotFound
+	_, err = pointer.resolve(ctx, download)
+	require.True(t, errors.Is(err, uplink.ErrObjectNotFound))
+
+	// pointers can't escape their bucket.
+	pointer = &rootPointer{bucket: "site", key: "CURRENT", ttl: time.Hour}
+	downloadErr = nil
+	for _, invalid := range []string{"", "../other", "a\nb"} {
+		contents = invalid
+		_, err = pointer.resolve(ctx, download)
+		require.Error(t, err, invalid)
+	}
+}
@@ -59,6 +59,7 @@ func (handler *Handler) handleStandard(ctx context.Context, w http.ResponseWrite
 
 	pr.access = access
 
+	pr.indexFiles = handler.indexFiles
 	pr.visibleKey = pr.realKey
 	pr.title = pr.bucket
 	pr.root = breadcrumb{Prefix: pr.bucket, URL: "/s/" + serializedAccess + "/" + pr.bucket + "/"}
@@ -0,0 +1,206 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+
+	"storj.io/uplink"
+)
+
+// staticHostsCheckInterval is how often the hosts file is checked for changes.
+const staticHostsCheckInterval = 10 * time.Second
+
+// staticHostConfig is an entry of the hosts file.
+type staticHostConfig struct {
+	Root   string `yaml:"root"`
+	Access string `yaml:"access"`
+}
+
+// staticHosts maps hostnames to the root and access of their sites from a
+// YAML or JSON file, which takes precedence over the txt records. The file is
+// reloaded when it changes. For example:
+//
+//	www.example.test:
+//	  root: bucket/prefix
+//	  access: 1Q84...
+//
+// The records of the sites are resolved and cached like the ones of txt
+// records, see txtRecords.queryAccess, so that they expire and their access
+// keys are revalidated the same way.
+type staticHosts struct {
+	log  *zap.Logger
+	path string
+	// changed is called with the hostnames whose entries changed when the
+	// file is reloaded, so that their cached records can be dropped.
+	changed func(hostnames []string)
+
+	mu      sync.RWMutex
+	hosts   map[string]staticHostConfig
+	modTime time.Time
+	size    int64
+}
+
+// newStaticHosts loads the hosts file at path.
+func newStaticHosts(log *zap.Logger, path string) (*staticHosts, error) {
+	hosts := &staticHosts{log: log, path: path}
+	if _, err := hosts.reload(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// lookup returns the entry of hostname, or false if the hosts file doesn't
+// contain it or there is no hosts file.
+func (hosts *staticHosts) lookup(hostname string) (_ staticHostConfig, ok bool) {
+	if hosts == nil {
+		return staticHostConfig{}, false
+	}
+
+	hosts.mu.RLock()
+	defer hosts.mu.RUnlock()
+
+	config, ok := hosts.hosts[strings.ToLower(hostname)]
+	return config, ok
+}
+
+// record resolves the record of a site of the hosts file. clientIP is the IP
+// of the client that originated the request.
+func (config staticHostConfig) record(ctx context.Context, auth AuthServiceConfig, clientIP string, ttl time.Duration) (_ *txtRecord, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	access, err := parseAccess(ctx, config.Access, auth, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	var accessKeyID string
+	if !isAccessGrant(config.Access) {
+		accessKeyID = config.Access
+	}
+	return &txtRecord{
+		access:      access,
+		ttl:         ttl,
+		site:        &siteRoot{root: config.Root},
+		accessKeyID: accessKeyID,
+		listing:     true,
+		showMap:     true,
+	}, nil
+}
+
+// contains reports whether hostname is in the hosts file.
+func (hosts *staticHosts) contains(hostname string) bool {
+	if hosts == nil {
+		return false
+	}
+
+	hosts.mu.RLock()
+	defer hosts.mu.RUnlock()
+
+	_, ok := hosts.hosts[strings.ToLower(hostname)]
+	return ok
+}
+
+// Run reloads the hosts file when it changes until ctx is canceled. A file
+// that fails to load is logged and the previous mapping is kept.
+func (hosts *staticHosts) Run(ctx context.Context) error {
+	ticker := time.NewTicker(staticHostsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		reloaded, err := hosts.reload()
+		if err != nil {
+			hosts.log.Error("unable to reload hosts file", zap.String("path", hosts.path), zap.Error(err))
+			continue
+		}
+		if reloaded {
+			hosts.log.Info("reloaded hosts file", zap.String("path", hosts.path))
+		}
+	}
+}
+
+// reload loads the hosts file if it changed since it was last loaded.
+func (hosts *staticHosts) reload() (reloaded bool, err error) {
+	info, err := os.Stat(hosts.path)
+	if err != nil {
+		return false, errs.Wrap(err)
+	}
+
+	hosts.mu.RLock()
+	unchanged := info.ModTime().Equal(hosts.modTime) && info.Size() == hosts.size
+	hosts.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(hosts.path)
+	if err != nil {
+		return false, errs.Wrap(err)
+	}
+	parsed, err := parseStaticHosts(data)
+	if err != nil {
+		return false, errs.New("invalid hosts file %q: %w", hosts.path, err)
+	}
+
+	hosts.mu.Lock()
+	var changed []string
+	for hostname, config := range parsed {
+		if previous, ok := hosts.hosts[hostname]; !ok || previous != config {
+			changed = append(changed, hostname)
+		}
+	}
+	for hostname := range hosts.hosts {
+		if _, ok := parsed[hostname]; !ok {
+			changed = append(changed, hostname)
+		}
+	}
+	hosts.hosts = parsed
+	hosts.modTime = info.ModTime()
+	hosts.size = info.Size()
+	hosts.mu.Unlock()
+
+	if hosts.changed != nil && len(changed) > 0 {
+		hosts.changed(changed)
+	}
+	return true, nil
+}
+
+// parseStaticHosts parses the contents of a hosts file. Being a superset of
+// JSON, YAML parsing covers both formats.
+func parseStaticHosts(data []byte) (map[string]staticHostConfig, error) {
+	var configs map[string]staticHostConfig
+	if err := yaml.UnmarshalStrict(data, &configs); err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]staticHostConfig, len(configs))
+	for hostname, config := range configs {
+		config.Root = strings.TrimSpace(config.Root)
+		config.Access = strings.TrimSpace(config.Access)
+		if config.Root == "" || config.Access == "" {
+			return nil, errs.New("host %q requires a root and an access", hostname)
+		}
+		if isAccessGrant(config.Access) {
+			if _, err := uplink.ParseAccess(config.Access); err != nil {
+				return nil, errs.New("host %q has an invalid access: %w", hostname, err)
+			}
+		}
+		hosts[strings.ToLower(strings.TrimSuffix(hostname, "."))] = config
+	}
+	return hosts, nil
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"storj.io/common/testcontext"
+)
+
+func TestStaticHosts(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	path := filepath.Join(t.TempDir(), "hosts.yaml")
+	write := func(contents string, modTime time.Time) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	now := time.Now()
+	write("www.Example.test:\n  root: bucket/prefix\n  access: "+serializedAccess+"\n", now)
+	hosts, err := newStaticHosts(zaptest.NewLogger(t), path)
+	require.NoError(t, err)
+	var changed []string
+	hosts.changed = func(hostnames []string) { changed = append(changed, hostnames...) }
+
+	config, ok := hosts.lookup("WWW.example.test")
+	require.True(t, ok)
+	require.Equal(t, "bucket/prefix", config.Root)
+	require.True(t, hosts.contains("www.example.test"))
+
+	_, ok = hosts.lookup("other.test")
+	require.False(t, ok)
+
+	// the sites of the hosts file are cached like txt records.
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour, static: hosts}, &DNSClient{}, AuthServiceConfig{})
+	record, err := records.fetchAccessForHost(ctx, "www.example.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "bucket/prefix", record.site.root)
+	require.Equal(t, time.Hour, record.ttl)
+	cached, err := records.fetchAccessForHost(ctx, "WWW.Example.test", "")
+	require.NoError(t, err)
+	require.Same(t, record, cached)
+
+	// an unchanged file isn't reloaded.
+	reloaded, err := hosts.reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// JSON works too, and only changed sites are reported.
+	write(`{"www.example.test": {"root": "bucket/prefix", "access": "`+serializedAccess+`"},
+		"docs.example.test": {"root": "docs", "access": "`+serializedAccess+`"}}`, now.Add(time.Second))
+	reloaded, err = hosts.reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.Equal(t, []string{"docs.example.test"}, changed)
+	require.True(t, hosts.contains("docs.example.test"))
+
+	// invalid files keep the previous mapping.
+	write("www.example.test:\n  root: bucket\n", now.Add(2*time.Second))
+	_, err = hosts.reload()
+	require.Error(t, err)
+	require.True(t, hosts.contains("docs.example.test"))
+
+	// changed and removed sites are reported.
+	changed = nil
+	write("www.example.test:\n  root: other\n  access: "+serializedAccess+"\n", now.Add(3*time.Second))
+	reloaded, err = hosts.reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.ElementsMatch(t, []string{"www.example.test", "docs.example.test"}, changed)
+
+	_, err = parseStaticHosts([]byte("site.test:\n  root: bucket\n  access: 1invalid\n  extra: field\n"))
+	require.Error(t, err)
+
+	var missing *staticHosts
+	_, ok = missing.lookup("www.example.test")
+	require.False(t, ok)
+	require.False(t, missing.contains("www.example.test"))
+}
+
+func TestStaticHostsAccessKeys(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"public":true,"access_grant":"` + serializedAccess + `"}`))
+		require.NoError(t, err)
+	}))
+	defer authServer.Close()
+	auth := AuthServiceConfig{BaseURL: authServer.URL}
+
+	config := staticHostConfig{Root: "bucket", Access: serializedAccess}
+	record, err := config.record(ctx, auth, "", time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, record.accessKeyIDs())
+
+	// access keys of the hosts file are revalidated like the ones of txt
+	// records.
+	config.Access = "accesskeyid"
+	record, err = config.record(ctx, auth, "", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []string{"accesskeyid"}, record.accessKeyIDs())
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// txtCacheItemOverhead approximates the memory used by a cache item
+	// besides its strings, mostly the parsed access grant.
+	txtCacheItemOverhead = 2048
+	// txtCacheCredentialSize approximates the memory used by a basic auth
+	// credential.
+	txtCacheCredentialSize = 128
+)
+
+// txtRecordCache is a cache of txt record entries bounded by the number of
+// entries and their approximate size, which evicts the least recently used
+// entries first. A zero bound disables it.
+type txtRecordCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	order *list.List // of *txtCacheItem, most recently used first
+	items map[string]*list.Element
+	bytes int64
+}
+
+// txtCacheItem is an entry in the txtRecordCache.
+type txtCacheItem struct {
+	hostname string
+	entry    *txtCacheEntry
+	size     int64
+}
+
+func newTxtRecordCache(maxEntries int, maxBytes int64) *txtRecordCache {
+	return &txtRecordCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+// Get returns the entry of hostname and marks it as recently used.
+func (cache *txtRecordCache) Get(hostname string) (*txtCacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, ok := cache.items[hostname]
+	if !ok {
+		mon.Counter("txt_record_cache_miss").Inc(1)
+		return nil, false
+	}
+	mon.Counter("txt_record_cache_hit").Inc(1)
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*txtCacheItem).entry, true
+}
+
+// Peek returns the entry of hostname without marking it as recently used.
+func (cache *txtRecordCache) Peek(hostname string) (*txtCacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, ok := cache.items[hostname]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*txtCacheItem).entry, true
+}
+
+// Store sets the entry of hostname, evicting the least recently used entries
+// while the cache is over its bounds.
+func (cache *txtRecordCache) Store(hostname string, entry *txtCacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	item := &txtCacheItem{
+		hostname: hostname,
+		entry:    entry,
+		size:     int64(len(hostname)) + entry.approxSize(),
+	}
+	if elem, ok := cache.items[hostname]; ok {
+		cache.bytes += item.size - elem.Value.(*txtCacheItem).size
+		elem.Value = item
+		cache.order.MoveToFront(elem)
+	} else {
+		cache.bytes += item.size
+		cache.items[hostname] = cache.order.PushFront(item)
+	}
+
+	for cache.order.Len() > 0 && cache.overLimits() {
+		mon.Counter("txt_record_cache_eviction").Inc(1)
+		cache.remove(cache.order.Back())
+	}
+	mon.IntVal("txt_record_cache_entries").Observe(int64(cache.order.Len()))
+	mon.IntVal("txt_record_cache_bytes").Observe(cache.bytes)
+}
+
+// Delete removes the entry of hostname.
+func (cache *txtRecordCache) Delete(hostname string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, ok := cache.items[hostname]; ok {
+		cache.remove(elem)
+	}
+}
+
+// Range calls fn for every entry in the cache, from the most to the least
+// recently used. fn must not use the cache.
+func (cache *txtRecordCache) Range(fn func(hostname string, entry *txtCacheEntry)) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for elem := cache.order.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*txtCacheItem)
+		fn(item.hostname, item.entry)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (cache *txtRecordCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.order.Len()
+}
+
+func (cache *txtRecordCache) overLimits() bool {
+	return (cache.maxEntries > 0 && cache.order.Len() > cache.maxEntries) ||
+		(cache.maxBytes > 0 && cache.bytes > cache.maxBytes)
+}
+
+func (cache *txtRecordCache) remove(elem *list.Element) {
+	item := cache.order.Remove(elem).(*txtCacheItem)
+	delete(cache.items, item.hostname)
+	cache.bytes -= item.size
+}
+
+// approxSize returns the approximate memory used by the entry.
+func (entry *txtCacheEntry) approxSize() int64 {
+	size := int64(txtCacheItemOverhead)
+	if entry.err != nil {
+		size += int64(len(entry.err.Error()))
+	}
+	if entry.refreshErr != nil {
+		size += int64(len(entry.refreshErr.Error()))
+	}
+	if record := entry.record; record != nil {
+		size += int64(len(record.spa))
+		if record.site != nil {
+			size += int64(len(record.site.root))
+		}
+		if record.pointer != nil {
+			size += int64(len(record.pointer.bucket)+len(record.pointer.key)) + txtCacheItemOverhead
+		}
+		if record.redirect != nil {
+			size += int64(len(record.redirect.target.String()))
+		}
+		for _, name := range record.indexFiles {
+			size += int64(len(name))
+		}
+		for _, mount := range record.mounts {
+			size += int64(len(mount.prefix) + len(mount.root))
+			if mount.access != nil {
+				size += txtCacheItemOverhead
+			}
+		}
+		if record.auth != nil {
+			size += int64(len(record.auth.credentials)) * txtCacheCredentialSize
+		}
+		if record.set != nil {
+			size += int64(len(record.name) + len(record.subdomain))
+			for key, values := range record.set.vals {
+				// the key is stored twice, with its original spelling.
+				size += int64(2 * len(key))
+				for _, value := range values {
+					size += int64(len(value))
+				}
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxtRecordCache(t *testing.T) {
+	entry := func(root string) *txtCacheEntry {
+		return &txtCacheEntry{record: &txtRecord{site: &siteRoot{root: root}}}
+	}
+
+	t.Run("entries", func(t *testing.T) {
+		cache := newTxtRecordCache(2, 0)
+		cache.Store("a.test", entry("a"))
+		cache.Store("b.test", entry("b"))
+
+		// using a makes b the least recently used.
+		_, ok := cache.Get("a.test")
+		require.True(t, ok)
+		cache.Store("c.test", entry("c"))
+
+		require.Equal(t, 2, cache.Len())
+		_, ok = cache.Peek("b.test")
+		require.False(t, ok)
+		got, ok := cache.Peek("a.test")
+		require.True(t, ok)
+		require.Equal(t, "a", got.record.site.root)
+
+		// replacing an entry doesn't evict anything.
+		cache.Store("c.test", entry("c2"))
+		require.Equal(t, 2, cache.Len())
+		got, ok = cache.Get("c.test")
+		require.True(t, ok)
+		require.Equal(t, "c2", got.record.site.root)
+
+		cache.Delete("a.test")
+		_, ok = cache.Get("a.test")
+		require.False(t, ok)
+		require.Equal(t, 1, cache.Len())
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		size := int64(len("a.test")) + entry("a").approxSize()
+		cache := newTxtRecordCache(0, 2*size)
+		cache.Store("a.test", entry("a"))
+		cache.Store("b.test", entry("b"))
+		require.Equal(t, 2, cache.Len())
+
+		cache.Store("c.test", entry("c"))
+		require.Equal(t, 2, cache.Len())
+		_, ok := cache.Peek("a.test")
+		require.False(t, ok)
+
+		// an entry bigger than the cache isn't kept.
+		cache.Store("d.test", entry(string(make([]byte, 3*size))))
+		require.Equal(t, 0, cache.Len())
+		require.Zero(t, cache.bytes)
+	})
+}
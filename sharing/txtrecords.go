@@ -5,6 +5,9 @@ package sharing
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,101 +17,341 @@ import (
 	"storj.io/uplink"
 )
 
-type txtRecords struct {
+// staleRetryInterval is how long a stale record served because refreshing it
+// failed is kept before trying to refresh it again.
+const staleRetryInterval = 10 * time.Second
+
+// txtRecordsConfig configures the caching of txt records.
+type txtRecordsConfig struct {
+	// maxTTL caps the TTL of the txt records.
 	maxTTL time.Duration
+	// negativeTTL is how long hostnames that aren't set up for hosting are
+	// cached. Zero disables negative caching.
+	negativeTTL time.Duration
+	// staleIfError is how long after its expiration a record keeps being
+	// served while refreshing it fails. Zero disables it.
+	staleIfError time.Duration
+
+	// maxEntries and maxBytes bound the number of cached records and their
+	// approximate size. Zero is unbounded.
+	maxEntries int
+	maxBytes   int64
+
+	// refreshWorkers is the number of workers refreshing records in the
+	// background.
+	refreshWorkers int
+	// revalidateInterval is how often records resolved from an access key
+	// are revalidated against the auth service. Zero disables it.
+	revalidateInterval time.Duration
+
+	// rootPointerTTL is how long the root named by a root pointer object is
+	// cached.
+	rootPointerTTL time.Duration
+
+	// targets are verified to be what hostnames resolve to before their
+	// txt records are trusted, unless nil.
+	targets *hostTargets
+
+	// static are the sites of the hosts file, which take precedence over
+	// the txt records, unless nil.
+	static *staticHosts
+
+	dnssec dnssecPolicies
+}
+
+type txtRecords struct {
+	config txtRecordsConfig
 	dns    *DNSClient
 	auth   AuthServiceConfig
 
-	cache       sync.Map
+	dnssecValidator *dnssecValidator
+
+	cache       *txtRecordCache
 	updateLocks MutexGroup
+	refresher   *txtRefresher
 }
 
-type txtRecord struct {
-	// TODO: storing the actual access grant in the cache saves us some
-	// work and a request to the auth service, so that's nice. however,
-	// by storing the actual access grant in the cache, the dns entry will
-	// live until TTL *even though* the access key it used may have gotten
-	// revoked sooner. this is a troubling problem for access keys, and
-	// implies we should only support revoking access grants and not support
-	// revoking access keys due to this confusion.
-	access     *uplink.Access
-	root       string
+// txtCacheEntry is the cached result of looking up the record of a hostname.
+// Entries are never modified once stored.
+type txtCacheEntry struct {
+	// record is the last good record of the hostname. It's nil for
+	// negatively cached hostnames.
+	record *txtRecord
+	// err is the error returned for negatively cached hostnames.
+	err error
+	// expiration is when the entry needs to be refreshed.
 	expiration time.Time
+	// refreshAt is when a record starts being refreshed in the background,
+	// shortly before its expiration.
+	refreshAt time.Time
+	// staleUntil is when record stops being served if refreshing it fails.
+	staleUntil time.Time
+	// refreshedAt is when record was last looked up successfully, and
+	// refreshErr is why refreshing it failed since then, if it did.
+	refreshedAt time.Time
+	refreshErr  error
+}
+
+type txtRecord struct {
+	// storing the actual access grant in the cache saves us some work and a
+	// request to the auth service, so that's nice. however, the access key
+	// it was resolved from may get revoked before the TTL expires, so
+	// records resolved from an access key are periodically revalidated
+	// against the auth service, see revalidateAccess.
+	access *uplink.Access
+	ttl    time.Duration
+
+	// site is the root the site is served from, unless it's resolved from
+	// the contents of an object by pointer.
+	site    *siteRoot
+	pointer *rootPointer
+
+	// accessKeyID is the access key the access grant was resolved from, or
+	// empty if the txt record holds the access grant itself.
+	accessKeyID string
+
+	// redirect redirects every request when set, in which case the record
+	// has neither an access nor a root.
+	redirect *hostRedirect
+
+	// mounts serve URL prefixes from other roots, longest prefix first.
+	mounts []siteMount
+
+	// spa is the object served with status 200 in place of any missing
+	// object, for single-page applications doing client-side routing.
+	spa string
+	// indexFiles overrides the index files from the configuration when set.
+	indexFiles []string
+
+	// listing, wrap, download and showMap are the presentation options of
+	// the site. see parsedRequest for their meaning.
+	listing  bool
+	wrap     bool
+	download bool
+	showMap  bool
+
+	// auth requires HTTP Basic authentication for the site when set.
+	auth *basicAuth
+
+	// set is the TXT record set the record was parsed from, name is the
+	// name of its TXT record and subdomain is the subdomain it's used for
+	// if it's a wildcard record. they are shown by the host info endpoint.
+	set       *TXTRecordSet
+	name      string
+	subdomain string
+}
+
+// accessKeyIDs returns the access keys the accesses of the record and its
+// mounts were resolved from.
+func (record *txtRecord) accessKeyIDs() (ids []string) {
+	if record.accessKeyID != "" {
+		ids = append(ids, record.accessKeyID)
+	}
+	for _, mount := range record.mounts {
+		if mount.accessKeyID != "" {
+			ids = append(ids, mount.accessKeyID)
+		}
+	}
+	return ids
 }
 
-func newTxtRecords(maxTTL time.Duration, dns *DNSClient, auth AuthServiceConfig) *txtRecords {
-	return &txtRecords{
-		maxTTL: maxTTL,
+func newTxtRecords(config txtRecordsConfig, dns *DNSClient, auth AuthServiceConfig) *txtRecords {
+	records := &txtRecords{
+		config: config,
 		dns:    dns,
 		auth:   auth,
+		cache:  newTxtRecordCache(config.maxEntries, config.maxBytes),
 	}
+	records.refresher = newTxtRefresher(records, config.refreshWorkers)
+	if config.dnssec.enabled() {
+		records.dnssecValidator = newDNSSECValidator(dns)
+	}
+	return records
+}
+
+// Run refreshes cached records in the background until ctx is canceled.
+// While it isn't running, expired records are refreshed synchronously.
+func (records *txtRecords) Run(ctx context.Context) error {
+	return records.refresher.Run(ctx)
 }
 
-// fetchAccessForHost fetches the root and access grant from the cache or dns
-// server when applicable. clientIP is the IP of the client that originated the
-// request.
-func (records *txtRecords) fetchAccessForHost(ctx context.Context, hostname string, clientIP string) (access *uplink.Access, root string, err error) {
+// fetchAccessForHost fetches the record holding the root and access grant
+// from the cache or dns server when applicable. clientIP is the IP of the
+// client that originated the request.
+func (records *txtRecords) fetchAccessForHost(ctx context.Context, hostname string, clientIP string) (record *txtRecord, err error) {
 	defer mon.Task()(&ctx)(&err)
 
-	val, ok := records.cache.Load(hostname)
+	hostname = strings.ToLower(hostname)
+
+	entry, ok := records.cache.Get(hostname)
 	if !ok {
 		// nothing in the cache, we have to go do a dns lookup before
 		// we can return.
-		record, err := records.updateCache(ctx, hostname, time.Time{}, clientIP)
-		if err != nil {
-			return nil, "", err
-		}
-		return record.access, record.root, nil
+		return records.updateCache(ctx, hostname, nil, clientIP)
 	}
 
 	// there's something in the cache!
-	record := val.(*txtRecord)
-	if record.expiration.Before(time.Now()) {
-		// but it's expired. okay, this happens a lot and is usually going to
-		// return the same value. we're going to be optimistic and assume the
-		// value is right and return the expired value, but update the cache
-		// in the background.
+	now := time.Now()
+	if entry.record == nil {
+		if entry.expiration.Before(now) {
+			// negatively cached entries aren't served once expired.
+			return records.updateCache(ctx, hostname, entry, clientIP)
+		}
+	} else if entry.refreshAt.Before(now) {
+		// it's expired or about to. okay, this happens a lot and is usually
+		// going to return the same value. we're going to be optimistic and
+		// assume the value is right and return the cached value, but update
+		// the cache in the background.
 		// the user experience if the dns entry changes is that the user will
 		// have to trigger a page load after the TTL expires to flush the
 		// cache, but usually users test their pages after making changes, so
 		// this should in practice be totally fine.
 		// this strategy saves us the initial dns request round trip most
 		// times.
-		go func(ctx context.Context, hostname string, record *txtRecord) {
-			_, _ = records.updateCache(ctx, hostname, record.expiration, clientIP)
-		}(ctx, hostname, record)
+		queued := records.refresher.enqueue(hostname, entry, clientIP)
+		if !queued && entry.expiration.Before(now) {
+			// nothing refreshes in the background, so do it now.
+			return records.updateCache(ctx, hostname, entry, clientIP)
+		}
 	}
 
-	return record.access, record.root, nil
+	if entry.record == nil {
+		mon.Event("txt_record_negative_hit")
+		return nil, entry.err
+	}
+	return entry.record, nil
 }
 
 // updateCache will attempt to fetch and update the dns record for the given
-// hostname. if there is a failure, updateCache will clear the cache and return
-// the error. If currentExpiration is nil, updateCache will do nothing if there
-// is already a cached value. If currentExpiration is set, updateCache will do
-// nothing if the currently cached expiration is different than
-// currentExpiration. clientIP is the IP of the client that originated the
-// request.
-func (records *txtRecords) updateCache(ctx context.Context, hostname string, currentExpiration time.Time, clientIP string) (record *txtRecord, err error) {
+// hostname. If current is nil, updateCache will do nothing if there is already
+// a cached entry. If current is set, updateCache will do nothing if the
+// cached entry is no longer current. clientIP is the IP of the client that
+// originated the request.
+//
+// If the hostname isn't set up for hosting, the failure is cached for the
+// negative TTL. If the lookup fails otherwise, the last good record keeps
+// being served until the stale-if-error window after its expiration ends.
+func (records *txtRecords) updateCache(ctx context.Context, hostname string, current *txtCacheEntry, clientIP string) (record *txtRecord, err error) {
 	defer mon.Task()(&ctx)(&err)
 	defer records.updateLocks.Lock(hostname)()
 
 	// check if the call to us raced with another updateCache.
-	if val, ok := records.cache.Load(hostname); ok {
-		record = val.(*txtRecord)
-		if currentExpiration.IsZero() || !record.expiration.Equal(currentExpiration) {
-			return record, nil
+	previous, ok := records.cache.Peek(hostname)
+	if ok {
+		if current == nil || previous != current {
+			if previous.record == nil {
+				return nil, previous.err
+			}
+			return previous.record, nil
 		}
 	}
 
-	record, err = records.queryAccessFromDNS(ctx, hostname, clientIP)
-	if err != nil {
+	now := time.Now()
+	record, err = records.queryAccess(ctx, hostname, clientIP)
+	switch {
+	case err == nil:
+		mon.Event("txt_record_refreshed")
+		expiration := now.Add(record.ttl)
+		records.cache.Store(hostname, &txtCacheEntry{
+			record:      record,
+			expiration:  expiration,
+			refreshAt:   expiration.Add(-refreshLead(record.ttl)),
+			staleUntil:  expiration.Add(records.config.staleIfError),
+			refreshedAt: now,
+		})
+		return record, nil
+
+	case isNegativeLookup(err):
+		mon.Event("txt_record_negative")
+		if records.config.negativeTTL > 0 {
+			records.cache.Store(hostname, &txtCacheEntry{
+				err:        err,
+				expiration: now.Add(records.config.negativeTTL),
+			})
+		} else {
+			records.cache.Delete(hostname)
+		}
+		return nil, err
+
+	case previous != nil && previous.record != nil && now.Before(previous.staleUntil):
+		mon.Event("txt_record_stale_if_error")
+		expiration := now.Add(staleRetryInterval)
+		if expiration.After(previous.staleUntil) {
+			expiration = previous.staleUntil
+		}
+		records.cache.Store(hostname, &txtCacheEntry{
+			record:      previous.record,
+			expiration:  expiration,
+			refreshAt:   expiration,
+			staleUntil:  previous.staleUntil,
+			refreshedAt: previous.refreshedAt,
+			refreshErr:  err,
+		})
+		return previous.record, nil
+
+	default:
+		mon.Event("txt_record_lookup_failure")
 		records.cache.Delete(hostname)
-		return record, err
+		return nil, err
 	}
+}
+
+// revalidateAccess resolves the access keys of the cached entry of hostname
+// again and evicts the entry if the auth service reports that one of them was
+// revoked, see isNegativeLookup. Other failures keep the entry. It does
+// nothing if entry is no longer the cached entry.
+func (records *txtRecords) revalidateAccess(ctx context.Context, hostname string, entry *txtCacheEntry) (err error) {
+	defer mon.Task()(&ctx)(&err)
+	defer records.updateLocks.Lock(hostname)()
 
-	records.cache.Store(hostname, record)
-	return record, nil
+	if current, ok := records.cache.Peek(hostname); !ok || current != entry {
+		return nil
+	}
+
+	var group errs.Group
+	for _, accessKeyID := range entry.record.accessKeyIDs() {
+		_, err := parseAccess(ctx, accessKeyID, records.auth, "")
+		if err == nil {
+			continue
+		}
+		if isNegativeLookup(err) {
+			mon.Event("access_revoked")
+			records.cache.Delete(hostname)
+			return nil
+		}
+		mon.Event("access_revalidation_failure")
+		group.Add(err)
+	}
+	return group.Err()
+}
+
+// isNegativeLookup reports whether err means that the hostname isn't set up
+// for hosting, that its TXT records are invalid, that it points elsewhere or
+// that its access key is unknown, revoked or not public, as opposed to a
+// failure that may go away when retried, such as the auth service rate
+// limiting requests. Such records must not be served, not even stale.
+func isNegativeLookup(err error) bool {
+	switch GetStatus(err, http.StatusInternalServerError) {
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusMisdirectedRequest,
+		http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	default:
+		return false
+	}
+}
+
+// queryAccess resolves the record of hostname from the hosts file if it
+// contains hostname and from its txt records otherwise. clientIP is the IP of
+// the client that originated the request.
+func (records *txtRecords) queryAccess(ctx context.Context, hostname string, clientIP string) (record *txtRecord, err error) {
+	if config, ok := records.config.static.lookup(hostname); ok {
+		record, err := config.record(ctx, records.auth, clientIP, records.config.maxTTL)
+		if err != nil {
+			return nil, errs.New("failure with hostname %q: %w", hostname, err)
+		}
+		return record, nil
+	}
+	return records.queryAccessFromDNS(ctx, hostname, clientIP)
 }
 
 // queryAccessFromDNS does an txt record lookup for the hostname on the DNS
@@ -117,32 +360,282 @@ func (records *txtRecords) updateCache(ctx context.Context, hostname string, cur
 func (records *txtRecords) queryAccessFromDNS(ctx context.Context, hostname string, clientIP string) (record *txtRecord, err error) {
 	defer mon.Task()(&ctx)(&err)
 
-	r, err := records.dns.Lookup(ctx, "txt-"+hostname, dns.TypeTXT)
+	set, name, subdomain, err := records.lookupHostingSet(ctx, hostname)
+	if err != nil {
+		return nil, errs.New("failure with hostname %q: %w", hostname, err)
+	}
+	if !isHostingSet(set) {
+		return nil, WithStatus(errs.New("hostname %q is not set up for hosting", hostname), http.StatusNotFound)
+	}
+	if err := records.verifyTarget(ctx, hostname); err != nil {
+		return nil, err
+	}
+
+	ttl := set.TTL()
+	if ttl > records.config.maxTTL {
+		ttl = records.config.maxTTL
+	}
+
+	// a redirected host needs neither an access nor a root.
+	redirect, err := parseHostRedirect(set)
 	if err != nil {
 		return nil, errs.New("failure with hostname %q: %w", hostname, err)
 	}
-	set := ResponseToTXTRecordSet(r)
+	if redirect != nil {
+		return &txtRecord{ttl: ttl, redirect: redirect, set: set, name: name, subdomain: subdomain}, nil
+	}
 
-	serializedAccess := set.Lookup("storj-access")
+	// a root pointer takes precedence over the root, so that a site can be
+	// moved to one before its storj-root record is removed.
+	serializedAccess, root := lookupHostingFields(set)
+	pointer, err := parseRootPointer(set, subdomain, records.config.rootPointerTTL)
+	if err != nil {
+		return nil, errs.New("failure with hostname %q: %w", hostname, err)
+	}
+	var site *siteRoot
+	if pointer == nil {
+		if subdomain != "" {
+			root, err = expandRoot(root, subdomain)
+			if err != nil {
+				return nil, errs.New("failure with hostname %q: %w", hostname, err)
+			}
+		}
+		site = &siteRoot{root: root}
+	}
+
+	access, err := parseAccess(ctx, serializedAccess, records.auth, clientIP)
+	if err != nil {
+		return nil, errs.New("failure with hostname %q: %w", hostname, err)
+	}
+
+	mounts, err := parseMounts(ctx, set, records.auth, clientIP)
+	if err != nil {
+		return nil, errs.New("failure with hostname %q: %w", hostname, err)
+	}
+
+	var accessKeyID string
+	if !isAccessGrant(serializedAccess) {
+		accessKeyID = serializedAccess
+	}
+
+	return &txtRecord{
+		access:      access,
+		ttl:         ttl,
+		site:        site,
+		pointer:     pointer,
+		accessKeyID: accessKeyID,
+		mounts:      mounts,
+		spa:         set.Lookup("storj-spa"),
+		indexFiles:  SplitList(set.Lookup("storj-index")),
+		listing:     lookupFlag(set, "storj-listing", true),
+		wrap:        lookupFlag(set, "storj-wrap", false),
+		download:    lookupFlag(set, "storj-download", false),
+		showMap:     lookupFlag(set, "storj-map", true),
+		auth:        parseBasicAuth(lookupList(set, "storj-auth")),
+		set:         set,
+		name:        name,
+		subdomain:   subdomain,
+	}, nil
+}
+
+// lookupTXT looks up the TXT record name of hostname, requesting DNSSEC
+// signatures if the policy for hostname validates them, see validateTXT.
+func (records *txtRecords) lookupTXT(ctx context.Context, hostname, name string) (r *dns.Msg, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	if records.config.dnssec.lookup(hostname) == DNSSECOff {
+		return records.dns.Lookup(ctx, name, dns.TypeTXT)
+	}
+	return records.dns.LookupDNSSEC(ctx, name, dns.TypeTXT)
+}
+
+// validateTXT validates the DNSSEC signatures of the TXT records of hostname
+// in r according to the policy for hostname. Only the records that set up
+// hosting are validated: a name without records just isn't used, and a
+// forged denial can only keep a site from being served, not serve it from
+// somewhere else.
+func (records *txtRecords) validateTXT(ctx context.Context, hostname string, r *dns.Msg) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	policy := records.config.dnssec.lookup(hostname)
+	if policy == DNSSECOff {
+		return nil
+	}
+
+	err = records.dnssecValidator.validate(ctx, r)
+	if err != nil && !(policy == DNSSECPrefer && errors.Is(err, errDNSSECUnsigned)) {
+		mon.Event("dnssec_validation_failure")
+		return WithStatus(err, http.StatusForbidden)
+	}
+	return nil
+}
+
+// checkHost returns an error unless hostname is set up for hosting, that is,
+// it has a valid record in the hosts file or TXT records with an access and a
+// root, or a redirect. It looks hostname up like fetchAccessForHost, so that
+// the result is cached either way: hostnames that aren't set up are cached
+// negatively and don't cost lookups on every TLS handshake.
+func (records *txtRecords) checkHost(ctx context.Context, hostname string) (err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	_, err = records.fetchAccessForHost(ctx, hostname, "")
+	return err
+}
+
+// verifyTarget returns an error unless hostname resolves to the link sharing
+// service, if that's to be verified.
+func (records *txtRecords) verifyTarget(ctx context.Context, hostname string) error {
+	if records.config.targets == nil {
+		return nil
+	}
+	return records.config.targets.verify(ctx, records.dns, hostname)
+}
+
+// txtRecordNames returns the names of the TXT records that may set up hosting
+// for hostname, in order of precedence: txt-<hostname>, _storj.<hostname> and
+// _storj-<hostname>. Unlike txt-<hostname>, _storj.<hostname> is within the
+// zone of hostname, which allows hosting apex domains.
+func txtRecordNames(hostname string) []string {
+	return []string{"txt-" + hostname, "_storj." + hostname, "_storj-" + hostname}
+}
+
+// lookupHostingSet looks up the TXT record set of hostname from the first of
+// its txtRecordNames that sets up hosting. If hostname has none, it falls back
+// to the wildcard records of its parent, such as txt-*.<parent>, in which case
+// subdomain is the first label of hostname. name is the name of the TXT record
+// the set was looked up from. The names of hostname are looked up
+// concurrently, so that the fallbacks don't add up to the latency of a
+// lookup, and the names of the wildcard only when hostname has none.
+func (records *txtRecords) lookupHostingSet(ctx context.Context, hostname string) (set *TXTRecordSet, name, subdomain string, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	set, name, err = records.lookupFirstHostingSet(ctx, hostname)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if isHostingSet(set) {
+		return set, name, "", nil
+	}
+
+	label, parent, ok := splitSubdomain(hostname)
+	if !ok {
+		return set, name, "", nil
+	}
+	wildcard, wildcardName, err := records.lookupFirstHostingSet(ctx, "*."+parent)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if isHostingSet(wildcard) {
+		mon.Event("txt_record_wildcard")
+		return wildcard, wildcardName, label, nil
+	}
+	return set, name, "", nil
+}
+
+// lookupFirstHostingSet looks up the txtRecordNames of hostname concurrently
+// and returns the TXT record set of the first one that sets up hosting, or of
+// the first name if none does. A failed lookup of a name before it fails, so
+// that a record of lower precedence is never used because of a transient
+// failure.
+func (records *txtRecords) lookupFirstHostingSet(ctx context.Context, hostname string) (set *TXTRecordSet, name string, err error) {
+	defer mon.Task()(&ctx)(&err)
+
+	names := txtRecordNames(hostname)
+	responses := make([]*dns.Msg, len(names))
+	lookupErrs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, candidate := range names {
+		wg.Add(1)
+		go func(i int, candidate string) {
+			defer wg.Done()
+			responses[i], lookupErrs[i] = records.lookupTXT(ctx, hostname, candidate)
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	for i, candidate := range names {
+		if lookupErrs[i] != nil {
+			return nil, "", lookupErrs[i]
+		}
+		candidateSet := ResponseToTXTRecordSet(responses[i])
+		if isHostingSet(candidateSet) {
+			if err := records.validateTXT(ctx, hostname, responses[i]); err != nil {
+				return nil, "", err
+			}
+			return candidateSet, candidate, nil
+		}
+		if i == 0 {
+			set, name = candidateSet, candidate
+		}
+	}
+	return set, name, nil
+}
+
+// isHostingSet reports whether a TXT record set sets up hosting, that is, it
+// has an access and a root or root pointer, or a redirect.
+func isHostingSet(set *TXTRecordSet) bool {
+	if set.Lookup("storj-redirect") != "" {
+		return true
+	}
+	serializedAccess, root := lookupHostingFields(set)
+	return serializedAccess != "" && (root != "" || set.Lookup("storj-root-pointer") != "")
+}
+
+// lookupHostingFields returns the access and root fields of a TXT record set,
+// falling back to their older names.
+func lookupHostingFields(set *TXTRecordSet) (serializedAccess, root string) {
+	serializedAccess = set.Lookup("storj-access")
 	if serializedAccess == "" {
 		// backcompat
 		serializedAccess = set.Lookup("storj-grant")
 	}
-	root := set.Lookup("storj-root")
+	root = set.Lookup("storj-root")
 	if root == "" {
 		// backcompat
 		root = set.Lookup("storj-path")
 	}
+	return serializedAccess, root
+}
 
-	access, err := parseAccess(ctx, serializedAccess, records.auth, clientIP)
-	if err != nil {
-		return nil, errs.New("failure with hostname %q: %w", hostname, err)
+// hostingFieldNames returns the names of the fields of a TXT record set the
+// access and root are found in, which may be their older names, or empty
+// names if they are missing.
+func hostingFieldNames(set *TXTRecordSet) (accessField, rootField string) {
+	for _, name := range []string{"storj-access", "storj-grant"} {
+		if set.Lookup(name) != "" {
+			accessField = name
+			break
+		}
 	}
+	for _, name := range []string{"storj-root-pointer", "storj-root", "storj-path"} {
+		if set.Lookup(name) != "" {
+			rootField = name
+			break
+		}
+	}
+	return accessField, rootField
+}
 
-	ttl := set.TTL()
-	if ttl > records.maxTTL {
-		ttl = records.maxTTL
+// lookupList returns the comma separated values of a field in a TXT record
+// set, which may also be defined more than once.
+func lookupList(set *TXTRecordSet, field string) (list []string) {
+	for _, value := range set.LookupAll(field) {
+		list = append(list, SplitList(value)...)
 	}
+	return list
+}
 
-	return &txtRecord{access: access, root: root, expiration: time.Now().Add(ttl)}, nil
+// lookupFlag finds a boolean field in a TXT record set, returning defValue if
+// it's not found. The values no, false, 0 and off (case insensitive) are
+// false and everything else is true.
+func lookupFlag(set *TXTRecordSet, field string, defValue bool) bool {
+	val := strings.TrimSpace(set.Lookup(field))
+	if val == "" {
+		return defValue
+	}
+	switch strings.ToLower(val) {
+	case "no", "false", "0", "off":
+		return false
+	}
+	return true
 }
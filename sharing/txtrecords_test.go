@@ -0,0 +1,264 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"storj.io/common/grant"
+	"storj.io/common/macaroon"
+	"storj.io/common/storj"
+	"storj.io/common/testcontext"
+)
+
+func TestLookupFlag(t *testing.T) {
+	set := NewTXTRecordSet()
+	set.Add("storj-listing:off", 0)
+	set.Add("storj-wrap:on", 0)
+	set.Add("storj-download:FALSE", 0)
+	set.Add("storj-map:", 0)
+	set.Finalize()
+
+	assert.False(t, lookupFlag(set, "storj-listing", true))
+	assert.True(t, lookupFlag(set, "storj-wrap", false))
+	assert.False(t, lookupFlag(set, "storj-download", true))
+	assert.True(t, lookupFlag(set, "storj-map", true))
+	assert.False(t, lookupFlag(set, "storj-missing", false))
+	assert.True(t, lookupFlag(set, "storj-missing", true))
+}
+
+// funcTransport answers dns queries with a function.
+type funcTransport func(m *dns.Msg) (*dns.Msg, error)
+
+func (transport funcTransport) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	return transport(m)
+}
+
+// newTestAccess returns a serialized access grant that parses without
+// contacting a satellite.
+func newTestAccess(t *testing.T) string {
+	apiKey, err := macaroon.NewAPIKey([]byte("secret"))
+	require.NoError(t, err)
+	access := &grant.Access{
+		SatelliteAddress: "1SYXsAycDPUu4z2ZksJD5fh5nTDcH3vCFHnpcVye5XuL1NrYV@127.0.0.1:7777",
+		APIKey:           apiKey,
+		EncAccess:        grant.NewEncryptionAccessWithDefaultKey(&storj.Key{}),
+	}
+	serialized, err := access.Serialize()
+	require.NoError(t, err)
+	return serialized
+}
+
+func TestTxtRecordsNegativeAndStaleCaching(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	var queries int64
+	var lookupErr error
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		atomic.AddInt64(&queries, 1)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		r := new(dns.Msg)
+		r.SetReply(m)
+		if m.Question[0].Name != "txt-site.test." {
+			r.Rcode = dns.RcodeNameError
+			return r, nil
+		}
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"storj-root:bucket", "storj-access:" + serializedAccess},
+		})
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{
+		maxTTL:       time.Hour,
+		negativeTTL:  time.Minute,
+		staleIfError: time.Hour,
+	}, &DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	// hostnames that aren't set up for hosting are negatively cached.
+	_, err := records.fetchAccessForHost(ctx, "other.test", "")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, GetStatus(err, 0))
+	_, err = records.fetchAccessForHost(ctx, "other.test", "")
+	require.Error(t, err)
+	require.EqualValues(t, len(txtRecordNames("other.test")), atomic.LoadInt64(&queries))
+	require.Error(t, records.checkHost(ctx, "other.test"))
+	require.EqualValues(t, len(txtRecordNames("other.test")), atomic.LoadInt64(&queries))
+
+	// so are hostnames that are only checked, as for on-demand TLS.
+	require.Error(t, records.checkHost(ctx, "unknown.test"))
+	checked := atomic.LoadInt64(&queries)
+	require.Error(t, records.checkHost(ctx, "unknown.test"))
+	require.Equal(t, checked, atomic.LoadInt64(&queries))
+
+	record, err := records.fetchAccessForHost(ctx, "site.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "bucket", record.site.root)
+
+	expire := func(staleUntil time.Time) *txtCacheEntry {
+		val, ok := records.cache.Peek("site.test")
+		require.True(t, ok)
+		entry := *val
+		entry.expiration = time.Now().Add(-time.Second)
+		entry.staleUntil = staleUntil
+		records.cache.Store("site.test", &entry)
+		return &entry
+	}
+
+	// the last good record is served while refreshing it fails.
+	lookupErr = errs.New("network unreachable")
+	entry := expire(time.Now().Add(time.Hour))
+	refreshed, err := records.updateCache(ctx, "site.test", entry, "")
+	require.NoError(t, err)
+	require.Same(t, record, refreshed)
+	val, ok := records.cache.Peek("site.test")
+	require.True(t, ok)
+	require.True(t, val.expiration.After(time.Now()))
+
+	// until the stale-if-error window ends.
+	entry = expire(time.Now().Add(-time.Second))
+	_, err = records.updateCache(ctx, "site.test", entry, "")
+	require.Error(t, err)
+	_, ok = records.cache.Peek("site.test")
+	require.False(t, ok)
+}
+
+func TestIsNegativeLookup(t *testing.T) {
+	for status, negative := range map[int]bool{
+		http.StatusNotFound:            true,
+		http.StatusBadRequest:          true,
+		http.StatusMisdirectedRequest:  true,
+		http.StatusUnauthorized:        true,
+		http.StatusForbidden:           true,
+		http.StatusTooManyRequests:     false,
+		httpStatusClientClosedRequest:  false,
+		http.StatusInternalServerError: false,
+		http.StatusServiceUnavailable:  false,
+	} {
+		require.Equal(t, negative, isNegativeLookup(WithStatus(errs.New("failure"), status)), status)
+	}
+	require.False(t, isNegativeLookup(errs.New("network unreachable")))
+}
+
+func TestTxtRecordsRevokedAccessKey(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	var revoked int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&revoked) != 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"public":true,"access_grant":"` + serializedAccess + `"}`))
+	}))
+	defer authServer.Close()
+
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"storj-root:bucket", "storj-access:accesskeyid"},
+		})
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{
+		maxTTL:       time.Hour,
+		negativeTTL:  time.Minute,
+		staleIfError: time.Hour,
+	}, &DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{BaseURL: authServer.URL})
+
+	_, err := records.fetchAccessForHost(ctx, "site.test", "")
+	require.NoError(t, err)
+
+	// a revoked access key isn't served stale once the record expires.
+	atomic.StoreInt32(&revoked, 1)
+	val, ok := records.cache.Peek("site.test")
+	require.True(t, ok)
+	entry := *val
+	entry.expiration = time.Now().Add(-time.Second)
+	entry.refreshAt = entry.expiration
+	records.cache.Store("site.test", &entry)
+
+	_, err = records.fetchAccessForHost(ctx, "site.test", "")
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, GetStatus(err, 0))
+	val, ok = records.cache.Peek("site.test")
+	require.True(t, ok)
+	require.Nil(t, val.record)
+}
+
+func TestTxtRecordNames(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	roots := map[string]string{
+		"txt-www.example.test.":     "txt-www",
+		"_storj.www.example.test.":  "storj-www",
+		"_storj.example.test.":      "storj-apex",
+		"_storj-docs.example.test.": "storj-docs",
+	}
+	var failing string
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		if m.Question[0].Name == failing {
+			return nil, errs.New("network unreachable")
+		}
+		r := new(dns.Msg)
+		r.SetReply(m)
+		root, ok := roots[m.Question[0].Name]
+		if !ok {
+			r.Rcode = dns.RcodeNameError
+			return r, nil
+		}
+		r.Answer = append(r.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{"storj-root:" + root, "storj-access:" + serializedAccess},
+		})
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	for hostname, root := range map[string]string{
+		// txt-<hostname> takes precedence over _storj.<hostname>.
+		"www.example.test":  "txt-www",
+		"example.test":      "storj-apex",
+		"docs.example.test": "storj-docs",
+	} {
+		record, err := records.queryAccessFromDNS(ctx, hostname, "")
+		require.NoError(t, err, hostname)
+		require.Equal(t, root, record.site.root, hostname)
+	}
+
+	// a failing lookup doesn't fall back to a record of lower precedence.
+	failing = "txt-example.test."
+	_, err := records.queryAccessFromDNS(ctx, "example.test", "")
+	require.Error(t, err)
+
+	// while the failing lookup of a record of lower precedence doesn't
+	// matter, and wildcards aren't even looked up.
+	for _, name := range []string{"_storj-www.example.test.", "txt-*.example.test."} {
+		failing = name
+		record, err := records.queryAccessFromDNS(ctx, "www.example.test", "")
+		require.NoError(t, err, name)
+		require.Equal(t, "txt-www", record.site.root, name)
+	}
+}
@@ -22,6 +22,7 @@ import (
 // but presents all of the key/value representations in a uniform manner.
 type TXTRecordSet struct {
 	vals   map[string][]string
+	names  map[string]string
 	minTTL time.Duration
 }
 
@@ -29,6 +30,7 @@ type TXTRecordSet struct {
 func NewTXTRecordSet() *TXTRecordSet {
 	return &TXTRecordSet{
 		vals:   map[string][]string{},
+		names:  map[string]string{},
 		minTTL: 24 * time.Hour,
 	}
 }
@@ -45,6 +47,9 @@ func (set *TXTRecordSet) Add(txt string, ttl time.Duration) {
 	key := strings.ToLower(fields[0])
 	key = strings.ReplaceAll(key, "_", "-")
 	set.vals[key] = append(set.vals[key], fields[1])
+	if _, ok := set.names[key]; !ok {
+		set.names[key] = fields[0]
+	}
 }
 
 // Finalize makes all values in the TXTRecordSet deterministic, regardless
@@ -79,5 +84,26 @@ func (set *TXTRecordSet) Lookup(field string) (value string) {
 	return value
 }
 
+// LookupAll returns all values of a given field in a TXT record set, for
+// fields that may be defined more than once. Unlike Lookup, it doesn't
+// concatenate numbered fields.
+func (set *TXTRecordSet) LookupAll(field string) (values []string) {
+	return append(values, set.vals[field]...)
+}
+
+// Fields returns the names of the fields starting with prefix, sorted and
+// spelled as they were first written in the TXT records, for fields whose
+// name carries a value of its own. The prefix is matched against the names
+// normalized like in Lookup.
+func (set *TXTRecordSet) Fields(prefix string) (names []string) {
+	for key, name := range set.names {
+		if strings.HasPrefix(key, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // TTL returns the minimum TTL seen in the reecord set.
 func (set *TXTRecordSet) TTL() time.Duration { return set.minTTL }
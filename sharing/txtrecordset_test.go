@@ -77,3 +77,25 @@ func TestFull(t *testing.T) {
 	require.Equal(t, set.Lookup("storj-root"), "oliosite/staging")
 	require.Equal(t, set.TTL(), 272*time.Second)
 }
+
+func TestLookupAll(t *testing.T) {
+	set := NewTXTRecordSet()
+	set.Add("storj-auth:bob:hash2", time.Hour)
+	set.Add("storj_auth:alice:hash1", time.Hour)
+	set.Finalize()
+
+	require.Equal(t, []string{"alice:hash1", "bob:hash2"}, set.LookupAll("storj-auth"))
+	require.Empty(t, set.LookupAll("storj-missing"))
+}
+
+func TestFields(t *testing.T) {
+	set := NewTXTRecordSet()
+	set.Add("storj-mount-/Blog:bucket2/posts", time.Hour)
+	set.Add("storj_mount-/assets:cdn-bucket", time.Hour)
+	set.Add("storj-root:bucket", time.Hour)
+	set.Finalize()
+
+	require.Equal(t, []string{"storj-mount-/Blog", "storj_mount-/assets"}, set.Fields("storj-mount-/"))
+	require.Equal(t, "bucket2/posts", set.Lookup("storj-mount-/blog"))
+	require.Empty(t, set.Fields("storj-missing"))
+}
@@ -51,6 +51,17 @@ func queryIntLookup(q url.Values, name string, defValue int) int {
 	return defValue
 }
 
+// SplitList splits a comma separated list, trimming spaces and dropping empty
+// entries.
+func SplitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // MutexGroup is a group of mutexes by name that attempts to only keep track of
 // live mutexes. The zero value is okay to use.
 type MutexGroup struct {
@@ -95,6 +106,31 @@ func (m *MutexGroup) Lock(name string) (unlock func()) {
 	}
 }
 
+// lazyValue is a value that is computed on first use. Unlike sync.Once, a
+// failed computation is not remembered and will be retried by the next call.
+// The zero value is okay to use.
+type lazyValue struct {
+	mu     sync.Mutex
+	loaded bool
+	value  interface{}
+}
+
+// get returns the value, calling load to compute it if it hasn't been
+// successfully computed yet.
+func (v *lazyValue) get(load func() (interface{}, error)) (interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.loaded {
+		return v.value, nil
+	}
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	v.value, v.loaded = value, true
+	return value, nil
+}
+
 // ExponentialBackoff keeps track of how long we should sleep between
 // failing attempts.
 type ExponentialBackoff struct {
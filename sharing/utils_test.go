@@ -227,3 +227,11 @@ func TestGetClientIP(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitList(t *testing.T) {
+	assert.Nil(t, SplitList(""))
+	assert.Nil(t, SplitList(" , ,"))
+	assert.Equal(t, []string{"index.html"}, SplitList("index.html"))
+	assert.Equal(t, []string{"index.html", "index.htm", "default.html"},
+		SplitList("index.html, index.htm,,default.html "))
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+	"go.uber.org/zap"
+)
+
+// warmupConcurrency is the number of hostnames resolved at once while warming
+// up the txt record cache.
+const warmupConcurrency = 16
+
+// txtWarmer warms up the txt record cache at startup with the configured
+// hostnames and the hostnames of the last snapshot of the cache, so that the
+// first visitors after a restart don't wait for DNS and the auth service. It
+// snapshots the hostnames of the cache periodically and on shutdown.
+type txtWarmer struct {
+	log     *zap.Logger
+	records *txtRecords
+
+	hostnames        []string
+	snapshotPath     string
+	snapshotInterval time.Duration
+}
+
+// newTxtWarmer returns a warmer for the configured hostnames, which are
+// combined with the hostnames listed in hostnamesPath if it's set.
+func newTxtWarmer(log *zap.Logger, records *txtRecords, hostnames []string, hostnamesPath, snapshotPath string, snapshotInterval time.Duration) (*txtWarmer, error) {
+	warmer := &txtWarmer{
+		log:              log,
+		records:          records,
+		snapshotPath:     snapshotPath,
+		snapshotInterval: snapshotInterval,
+	}
+	for _, hostname := range hostnames {
+		if hostname = strings.TrimSpace(hostname); hostname != "" {
+			warmer.hostnames = append(warmer.hostnames, strings.ToLower(hostname))
+		}
+	}
+	if hostnamesPath != "" {
+		listed, err := readHostnames(hostnamesPath)
+		if err != nil {
+			return nil, err
+		}
+		warmer.hostnames = append(warmer.hostnames, listed...)
+	}
+	return warmer, nil
+}
+
+// Run warms up the cache and then snapshots it every snapshot interval, if
+// it's positive, until ctx is canceled, when it takes a last snapshot.
+func (warmer *txtWarmer) Run(ctx context.Context) error {
+	hostnames := warmer.hostnames
+	if warmer.snapshotPath != "" {
+		snapshot, err := readHostnames(warmer.snapshotPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			warmer.log.Error("unable to read txt record cache snapshot", zap.String("path", warmer.snapshotPath), zap.Error(err))
+		}
+		hostnames = append(hostnames, snapshot...)
+	}
+	warmer.warm(ctx, hostnames)
+
+	if warmer.snapshotPath == "" {
+		return nil
+	}
+
+	var tick <-chan time.Time
+	if warmer.snapshotInterval > 0 {
+		ticker := time.NewTicker(warmer.snapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			warmer.saveSnapshot()
+			return ctx.Err()
+		case <-tick:
+			warmer.saveSnapshot()
+		}
+	}
+}
+
+// warm resolves the txt records of hostnames that aren't cached yet.
+func (warmer *txtWarmer) warm(ctx context.Context, hostnames []string) {
+	if len(hostnames) == 0 {
+		return
+	}
+
+	start := time.Now()
+	queue := make(chan string)
+	var mu sync.Mutex
+	var failed int
+
+	var wg sync.WaitGroup
+	for i := 0; i < warmupConcurrency && i < len(hostnames); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hostname := range queue {
+				lookupCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+				_, err := warmer.records.updateCache(lookupCtx, hostname, nil, "")
+				cancel()
+				if err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		if seen[hostname] {
+			continue
+		}
+		seen[hostname] = true
+		select {
+		case queue <- hostname:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	mon.IntVal("txt_record_warmup_failures").Observe(int64(failed))
+	warmer.log.Info("warmed up txt record cache",
+		zap.Int("hostnames", len(seen)),
+		zap.Int("failed", failed),
+		zap.Duration("duration", time.Since(start)))
+}
+
+// saveSnapshot writes the hostnames of the records in the cache to the
+// snapshot file, from the most to the least recently used. Negatively cached
+// hostnames are left out.
+func (warmer *txtWarmer) saveSnapshot() {
+	var buf bytes.Buffer
+	warmer.records.cache.Range(func(hostname string, entry *txtCacheEntry) {
+		if entry.record != nil {
+			buf.WriteString(hostname)
+			buf.WriteByte('\n')
+		}
+	})
+
+	if err := writeFileAtomic(warmer.snapshotPath, buf.Bytes()); err != nil {
+		warmer.log.Error("unable to save txt record cache snapshot", zap.String("path", warmer.snapshotPath), zap.Error(err))
+	}
+}
+
+// readHostnames reads a file listing one hostname per line. Empty lines and
+// lines starting with # are ignored.
+func readHostnames(path string) (hostnames []string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hostnames = append(hostnames, strings.ToLower(line))
+	}
+	return hostnames, errs.Wrap(scanner.Err())
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers never
+// see a partially written file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return errs.Combine(errs.Wrap(err), tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return errs.Wrap(err)
+	}
+	return errs.Wrap(os.Rename(tmp.Name(), path))
+}
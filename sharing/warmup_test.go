@@ -0,0 +1,74 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"storj.io/common/testcontext"
+)
+
+func TestTxtWarmer(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		switch m.Question[0].Name {
+		case "txt-a.test.", "txt-b.test.", "txt-c.test.":
+			r.Answer = append(r.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"storj-root:bucket", "storj-access:" + serializedAccess},
+			})
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour, negativeTTL: time.Minute},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	dir := t.TempDir()
+	hostnamesPath := filepath.Join(dir, "hostnames")
+	require.NoError(t, ioutil.WriteFile(hostnamesPath, []byte("# hosted sites\nB.test\n\nmissing.test\n"), 0644))
+	snapshotPath := filepath.Join(dir, "snapshot")
+	require.NoError(t, ioutil.WriteFile(snapshotPath, []byte("c.test\na.test\n"), 0644))
+
+	// without a snapshot interval, the snapshot is only saved on shutdown.
+	warmer, err := newTxtWarmer(zaptest.NewLogger(t), records, []string{" a.test", ""}, hostnamesPath, snapshotPath, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.test", "b.test", "missing.test"}, warmer.hostnames)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- warmer.Run(runCtx) }()
+
+	require.Eventually(t, func() bool { return records.cache.Len() == 4 }, 10*time.Second, 10*time.Millisecond)
+	for _, hostname := range []string{"a.test", "b.test", "c.test"} {
+		entry, ok := records.cache.Peek(hostname)
+		require.True(t, ok, hostname)
+		require.NotNil(t, entry.record, hostname)
+	}
+
+	// the last snapshot is saved on shutdown, without negatively cached
+	// hostnames.
+	cancel()
+	require.True(t, errors.Is(<-done, context.Canceled))
+	snapshot, err := readHostnames(snapshotPath)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a.test", "b.test", "c.test"}, snapshot)
+
+	_, err = newTxtWarmer(zaptest.NewLogger(t), records, nil, filepath.Join(dir, "nonexistent"), "", 0)
+	require.Error(t, err)
+}
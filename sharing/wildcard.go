@@ -0,0 +1,62 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// subdomainPlaceholder is replaced in the root of a wildcard record by the
+// subdomain the site is requested on.
+const subdomainPlaceholder = "{subdomain}"
+
+// splitSubdomain splits hostname into its first label and its parent domain,
+// for looking up the wildcard record txt-*.<parent>. It returns false if the
+// label isn't a valid DNS label or the parent is a top-level domain.
+func splitSubdomain(hostname string) (label, parent string, ok bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	i := strings.IndexByte(hostname, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	label, parent = hostname[:i], hostname[i+1:]
+	if !isValidLabel(label) || !strings.Contains(parent, ".") {
+		return "", "", false
+	}
+	return label, parent, true
+}
+
+// isValidLabel reports whether label is a valid DNS label made of letters,
+// digits and hyphens, which makes it safe to use in object keys.
+func isValidLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// expandRoot replaces the subdomain placeholder in the root of a wildcard
+// record. The placeholder may only be used in the prefix, so that subdomains
+// stay within the bucket, and subdomain must be a valid label, so that it
+// can't escape the prefix.
+func expandRoot(root, subdomain string) (string, error) {
+	if !strings.Contains(root, subdomainPlaceholder) {
+		return root, nil
+	}
+	if bucket := strings.SplitN(root, "/", 2)[0]; strings.Contains(bucket, subdomainPlaceholder) {
+		return "", WithStatus(errs.New("%s can't be used in the bucket of root %q", subdomainPlaceholder, root), http.StatusBadRequest)
+	}
+	if !isValidLabel(subdomain) {
+		return "", WithStatus(errs.New("invalid subdomain %q", subdomain), http.StatusBadRequest)
+	}
+	return strings.ReplaceAll(root, subdomainPlaceholder, subdomain), nil
+}
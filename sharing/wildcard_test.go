@@ -0,0 +1,85 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package sharing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/common/testcontext"
+)
+
+func TestSplitSubdomain(t *testing.T) {
+	label, parent, ok := splitSubdomain("PR-42.preview.example.test.")
+	require.True(t, ok)
+	require.Equal(t, "pr-42", label)
+	require.Equal(t, "preview.example.test", parent)
+
+	for _, invalid := range []string{"example", "example.test", "-a.example.test", "a_b.example.test", "..example.test", "*.example.test"} {
+		_, _, ok := splitSubdomain(invalid)
+		require.False(t, ok, invalid)
+	}
+}
+
+func TestExpandRoot(t *testing.T) {
+	root, err := expandRoot("previews/{subdomain}/", "pr-42")
+	require.NoError(t, err)
+	require.Equal(t, "previews/pr-42/", root)
+
+	root, err = expandRoot("previews/main", "pr-42")
+	require.NoError(t, err)
+	require.Equal(t, "previews/main", root)
+
+	_, err = expandRoot("{subdomain}/site", "pr-42")
+	require.Error(t, err)
+	_, err = expandRoot("previews/{subdomain}/", "..")
+	require.Error(t, err)
+	_, err = expandRoot("previews/{subdomain}/", "a/b")
+	require.Error(t, err)
+}
+
+func TestWildcardHosting(t *testing.T) {
+	ctx := testcontext.New(t)
+
+	serializedAccess := newTestAccess(t)
+	transport := funcTransport(func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		switch m.Question[0].Name {
+		case "txt-*.preview.example.test.":
+			r.Answer = append(r.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"storj-root:previews/{subdomain}/", "storj-access:" + serializedAccess},
+			})
+		case "txt-main.preview.example.test.":
+			r.Answer = append(r.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{"storj-root:site/main", "storj-access:" + serializedAccess},
+			})
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+
+	records := newTxtRecords(txtRecordsConfig{maxTTL: time.Hour},
+		&DNSClient{servers: []*dnsServer{{addr: "fake", transport: transport}}}, AuthServiceConfig{})
+
+	record, err := records.fetchAccessForHost(ctx, "pr-42.preview.example.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "previews/pr-42/", record.site.root)
+
+	// a record of its own takes precedence over the wildcard record.
+	record, err = records.fetchAccessForHost(ctx, "main.preview.example.test", "")
+	require.NoError(t, err)
+	require.Equal(t, "site/main", record.site.root)
+
+	require.NoError(t, records.checkHost(ctx, "pr-43.preview.example.test"))
+	require.Error(t, records.checkHost(ctx, "www.example.test"))
+	_, err = records.fetchAccessForHost(ctx, "a_b.preview.example.test", "")
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@ go 1.13
 replace storj.io/linksharing => ../
 
 require (
+	github.com/miekg/dns v1.0.14
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/zap v1.16.0
 	storj.io/common v0.0.0-20210601214904-24681cb3da97
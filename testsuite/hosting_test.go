@@ -0,0 +1,269 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package testsuite
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"storj.io/common/testcontext"
+	"storj.io/linksharing/objectmap"
+	"storj.io/linksharing/sharing"
+	"storj.io/storj/private/testplanet"
+)
+
+func TestHostedSite(t *testing.T) {
+	testplanet.Run(t, testplanet.Config{
+		SatelliteCount:   1,
+		StorageNodeCount: 1,
+		UplinkCount:      1,
+	}, testHostedSite)
+}
+
+func testHostedSite(t *testing.T, ctx *testcontext.Context, planet *testplanet.Planet) {
+	for key, content := range map[string]string{
+		"site/index.html":       "HOME",
+		"site/about.html":       "ABOUT",
+		"site/docs/index.html":  "DOCS",
+		"site/docs/default.htm": "DOCS DEFAULT",
+		"site/blog/home.html":   "BLOG HOME",
+		"site/blog/index.html":  "BLOG INDEX",
+		"site/files/data.txt":   "DATA",
+		"site/404.html":         "SITE NOT FOUND",
+		"manual/index.html":     "MANUAL",
+		"manual/404.html":       "MANUAL NOT FOUND",
+		"app/index.html":        "APP",
+		"app/_headers":          "/index.html\n  Cache-Control: no-cache\n",
+	} {
+		err := planet.Uplinks[0].Upload(ctx, planet.Satellites[0], "testbucket", key, []byte(content))
+		require.NoError(t, err)
+	}
+
+	access := planet.Uplinks[0].Access[planet.Satellites[0].ID()]
+	serializedAccess, err := access.Serialize()
+	require.NoError(t, err)
+
+	dnsServer, shutdown := startTXTServer(ctx, t, map[string][]string{
+		"txt-site.test.":    {"storj-root:testbucket/site"},
+		"txt-custom.test.":  {"storj-root:testbucket/site", "storj-index:home.html,index.html", "storj-mount-/manual:testbucket/manual"},
+		"txt-private.test.": {"storj-root:testbucket/site", "storj-listing:off", "storj-map:off"},
+		"txt-app.test.":     {"storj-root:testbucket/app", "storj-spa:index.html"},
+		"txt-no-spa.test.":  {"storj-root:testbucket/site", "storj-spa:app.html"},
+	}, serializedAccess)
+	defer ctx.Check(shutdown)
+
+	mapper := objectmap.NewIPDB(&objectmap.MockReader{})
+
+	for _, testCase := range []struct {
+		name       string
+		host       string
+		path       string
+		indexFiles []string
+		status     int
+		body       string
+		location   string
+		header     http.Header
+	}{
+		{
+			name:   "index document of the root",
+			host:   "site.test",
+			path:   "/",
+			status: http.StatusOK,
+			body:   "HOME",
+		},
+		{
+			name:   "clean url served by key.html",
+			host:   "site.test",
+			path:   "/about",
+			status: http.StatusOK,
+			body:   "ABOUT",
+		},
+		{
+			name:     "clean url redirects to key/ with an index document",
+			host:     "site.test",
+			path:     "/docs",
+			status:   http.StatusSeeOther,
+			location: "/docs/",
+		},
+		{
+			name:     "prefix without index document redirects",
+			host:     "site.test",
+			path:     "/files",
+			status:   http.StatusSeeOther,
+			location: "/files/",
+		},
+		{
+			name:   "listing of a prefix without index document",
+			host:   "site.test",
+			path:   "/files/",
+			status: http.StatusOK,
+		},
+		{
+			name:   "listing disabled",
+			host:   "private.test",
+			path:   "/files/",
+			status: http.StatusNotFound,
+			body:   "SITE NOT FOUND",
+		},
+		{
+			name:   "listing disabled does not redirect to a prefix",
+			host:   "private.test",
+			path:   "/files",
+			status: http.StatusNotFound,
+			body:   "SITE NOT FOUND",
+		},
+		{
+			name:   "map disabled serves the object",
+			host:   "private.test",
+			path:   "/about.html?map=1",
+			status: http.StatusOK,
+			body:   "ABOUT",
+		},
+		{
+			name:       "global index files in order",
+			host:       "site.test",
+			path:       "/docs/",
+			indexFiles: []string{"default.htm", "index.html"},
+			status:     http.StatusOK,
+			body:       "DOCS DEFAULT",
+		},
+		{
+			name:   "default index file",
+			host:   "site.test",
+			path:   "/blog/",
+			status: http.StatusOK,
+			body:   "BLOG INDEX",
+		},
+		{
+			name:       "per-host index files take precedence",
+			host:       "custom.test",
+			path:       "/blog/",
+			indexFiles: []string{"default.htm"},
+			status:     http.StatusOK,
+			body:       "BLOG HOME",
+		},
+		{
+			name:     "mount without a trailing slash redirects",
+			host:     "custom.test",
+			path:     "/Manual?lang=en",
+			status:   http.StatusSeeOther,
+			location: "/Manual/?lang=en",
+		},
+		{
+			name:   "mount paths are case-insensitive",
+			host:   "custom.test",
+			path:   "/Manual/",
+			status: http.StatusOK,
+			body:   "MANUAL",
+		},
+		{
+			name:   "error page of the site",
+			host:   "site.test",
+			path:   "/missing",
+			status: http.StatusNotFound,
+			body:   "SITE NOT FOUND",
+		},
+		{
+			name:   "error page of a mount",
+			host:   "custom.test",
+			path:   "/manual/missing",
+			status: http.StatusNotFound,
+			body:   "MANUAL NOT FOUND",
+		},
+		{
+			name:   "deep link of a single-page application",
+			host:   "app.test",
+			path:   "/dashboard/settings",
+			status: http.StatusOK,
+			body:   "APP",
+			header: http.Header{"Cache-Control": {"no-cache"}},
+		},
+		{
+			name:   "missing single-page application entry",
+			host:   "no-spa.test",
+			path:   "/dashboard/settings",
+			status: http.StatusNotFound,
+			body:   "SITE NOT FOUND",
+		},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			handler, err := sharing.NewHandler(zaptest.NewLogger(t), mapper, sharing.Config{
+				URLBases:     []string{"http://localhost"},
+				Templates:    "./../web/",
+				TxtRecordTTL: time.Hour,
+				DNSServers:   []string{dnsServer},
+				IndexFiles:   testCase.indexFiles,
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+testCase.host+testCase.path, nil)
+			require.NoError(t, err)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, testCase.status, w.Code, "status code does not match")
+			if testCase.body != "" {
+				assert.Equal(t, testCase.body, w.Body.String(), "body does not match")
+			}
+			if testCase.location != "" {
+				assert.Equal(t, testCase.location, w.Header().Get("Location"), "location does not match")
+			}
+			for name, values := range testCase.header {
+				assert.Equal(t, values, w.Header().Values(name), "header %s does not match", name)
+			}
+		})
+	}
+}
+
+// startTXTServer starts a DNS server over TCP that answers TXT queries for
+// the names of records, which are given the storj-access field with access,
+// split as it would be in TXT records. It returns the address of the server
+// and a function shutting it down.
+func startTXTServer(ctx *testcontext.Context, t *testing.T, records map[string][]string, access string) (addr string, shutdown func() error) {
+	var accessFields []string
+	for i := 0; len(access) > 0; i++ {
+		n := 200
+		if n > len(access) {
+			n = len(access)
+		}
+		accessFields = append(accessFields, fmt.Sprintf("storj-access-%d:%s", i+1, access[:n]))
+		access = access[n:]
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		fields, ok := records[strings.ToLower(req.Question[0].Name)]
+		if !ok || req.Question[0].Qtype != dns.TypeTXT {
+			resp.Rcode = dns.RcodeNameError
+			_ = w.WriteMsg(resp)
+			return
+		}
+		for _, field := range append(fields, accessFields...) {
+			resp.Answer = append(resp.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{field},
+			})
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{Listener: listener, Handler: handler}
+	ctx.Go(server.ActivateAndServe)
+
+	return listener.Addr().String(), server.Shutdown
+}